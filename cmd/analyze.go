@@ -6,6 +6,8 @@ import (
 	"errors"
 	"io"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 )
@@ -15,6 +17,13 @@ var (
 	outputDir        string
 	generateJSON     bool
 	generateMarkdown bool
+	deviceSpecs      []string
+	linkMaps         []string
+	mappingPath      string
+	rankByDownload   bool
+	blockSize        int64
+	archiveLimits    analyzer.ArchiveLimits
+	keepWorkdir      bool
 )
 
 var annotateCmd = &cobra.Command{
@@ -46,7 +55,31 @@ var annotateCmd = &cobra.Command{
 			return errors.New("app_path is empty")
 		}
 
-		bundle, err := analyzer.AnalyzeBundlePath(app_path)
+		// Every scratch file of the run lives in the workspace, which is
+		// removed when the analysis ends, fails or is interrupted
+		workspace, err := analyzer.NewWorkspace(keepWorkdir)
+		if err != nil {
+			return err
+		}
+		defer workspace.Cleanup()
+
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(interrupt)
+		go func() {
+			<-interrupt
+			workspace.Cleanup()
+			os.Exit(130)
+		}()
+
+		bundle, err := analyzer.AnalyzeBundlePath(app_path, analyzer.Options{
+			DeviceSpecPaths: deviceSpecs,
+			LinkMapPaths:    linkMaps,
+			BlockSize:       blockSize,
+			ArchiveLimits:   archiveLimits,
+			Workspace:       workspace,
+			MappingPath:     mappingPath,
+		})
 		if err != nil {
 			return err
 		}
@@ -77,7 +110,7 @@ var annotateCmd = &cobra.Command{
 		}
 
 		if generateMarkdown {
-			if err := visualize.GenerateMarkdown(bundle, outputDir); err != nil {
+			if err := visualize.GenerateMarkdown(bundle, outputDir, rankByDownload); err != nil {
 				return err
 			}
 		}
@@ -91,5 +124,14 @@ func init() {
 	annotateCmd.Flags().BoolVar(&generateHTML, "html", false, "Generate HTML visualization")
 	annotateCmd.Flags().BoolVar(&generateJSON, "json", false, "Generate JSON output file")
 	annotateCmd.Flags().BoolVar(&generateMarkdown, "markdown", false, "Generate Markdown report")
+	annotateCmd.Flags().BoolVar(&rankByDownload, "rank-by-download", false, "Rank modules and files in the Markdown report by download size instead of install size")
+	annotateCmd.Flags().StringArrayVar(&deviceSpecs, "device-spec", nil, "bundletool device-spec JSON file to estimate AAB download and install sizes for (can be repeated)")
+	annotateCmd.Flags().StringArrayVar(&linkMaps, "link-map", nil, "Xcode link map (LD_GENERATE_MAP_FILE) of a Mach-O binary of the bundle, to attribute its size to static libraries and pods (can be repeated)")
+	annotateCmd.Flags().StringVar(&mappingPath, "mapping", "", "R8 or ProGuard mapping.txt to restore the obfuscated class and package names of DEX files with")
+	annotateCmd.Flags().Int64Var(&blockSize, "block-size", analyzer.DefaultBlockSize, "Filesystem block size in bytes the install size of iOS apps is rounded up to")
+	annotateCmd.Flags().IntVar(&archiveLimits.MaxEntries, "max-entries", analyzer.DefaultArchiveLimits.MaxEntries, "Maximum number of entries of the analyzed archive")
+	annotateCmd.Flags().Int64Var(&archiveLimits.MaxUncompressedSize, "max-uncompressed-size", analyzer.DefaultArchiveLimits.MaxUncompressedSize, "Maximum total uncompressed size in bytes of the analyzed archive")
+	annotateCmd.Flags().Float64Var(&archiveLimits.MaxCompressionRatio, "max-compression-ratio", analyzer.DefaultArchiveLimits.MaxCompressionRatio, "Maximum compression ratio of a single entry of the analyzed archive")
+	annotateCmd.Flags().BoolVar(&keepWorkdir, "keep-workdir", false, "Keep the temporary files extracted during the analysis for debugging")
 	annotateCmd.Flags().StringVar(&outputDir, "output-dir", "", "Directory where the output files will be generated (default: current directory)")
 }
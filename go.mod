@@ -3,6 +3,7 @@ module bitrise-plugins-analyze
 go 1.21
 
 require (
+	github.com/ianlancetaylor/demangle v0.0.0-20260724033716-83e58baca724
 	github.com/spf13/cobra v1.9.1
 	howett.net/plist v1.0.1
 )
@@ -1,62 +1,64 @@
 package analyzer
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
+	"strings"
 )
 
-func analyzeAndroidBundle(bundle_path string) (*AppBundle, error) {
+func analyzeAndroidBundle(bundle_path string, options Options) (*AppBundle, error) {
 	ext := filepath.Ext(bundle_path)
 
 	if ext == ApkExtension {
-		return analyzeApk(bundle_path)
+		return analyzeApk(bundle_path, options)
 	} else if ext == AabExtension {
-		bundle_path, err := analyzeAab(bundle_path)
-		defer os.RemoveAll(bundle_path)
-
+		bundle, err := analyzeAab(bundle_path, options)
 		if err != nil {
-			return nil, fmt.Errorf("failed to analyze AAB: %v", err)
+			return nil, fmt.Errorf("failed to analyze AAB: %w", err)
 		}
 
-		return analyzeApk(bundle_path)
+		return bundle, nil
+	} else if ext == ApksExtension {
+		return analyzeApks(bundle_path, options)
 	}
 
 	return nil, fmt.Errorf("unsupported Android file type: %s", ext)
 }
 
-func analyzeApk(apkPath string) (*AppBundle, error) {
+func analyzeApk(apkPath string, options Options) (*AppBundle, error) {
 	// Create bundle info
 	bundle := &AppBundle{}
 
-	// Parse AndroidManifest.xml using apkanalyzer
-	manifest, err := parseAndroidManifest(apkPath)
+	// Analyze the APK in place
+	archive, err := openArchive(apkPath, options.ArchiveLimits, options.Workspace)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse AndroidManifest.xml: %v", err)
+		return nil, fmt.Errorf("failed to open APK: %w", err)
 	}
+	defer archive.Close()
 
-	// Set bundle metadata from manifest
-	bundle.AppName = "Todo"
-	bundle.BundleID = manifest.Package
-	bundle.Version = manifest.VersionName + " (" + manifest.VersionCode + ")"
-
-	unzipedApkDir, err := unzip(apkPath)
+	// Parse the binary AndroidManifest.xml
+	manifest, err := parseAndroidManifest(archive)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unzip APK: %v", err)
+		return nil, fmt.Errorf("failed to parse AndroidManifest.xml: %v", err)
 	}
 
+	// Set bundle metadata from manifest
+	setManifestMetadata(bundle, manifest)
+
 	// Analyze the APK files
-	files, err := AnalyzeFile(unzipedApkDir, unzipedApkDir)
+	files, err := AnalyzeFile(archive, ".")
 	if err != nil {
 		return nil, err
 	}
+	setArchiveCompressedSizes(&files, archive)
 	bundle.Files = files
 
-	// Analyze DEX files
-	// TODO: Export DEX files to file structure under the unzipped APK
-	// Only after run analyzeFile as it will correctly setup the file structure
-	dexPackages, err := analyzeDexFiles(unzipedApkDir)
+	// Analyze DEX files, their packages are nested under the .dex nodes by FilesIncludingMetaInformation
+	dexPackages, err := analyzeDexFiles(archive, options.mapping)
 	if err != nil {
 		// Log the error but don't fail the analysis
 		fmt.Printf("Warning: failed to analyze DEX files: %v\n", err)
@@ -64,6 +66,27 @@ func analyzeApk(apkPath string) (*AppBundle, error) {
 		bundle.DexPackages = dexPackages
 	}
 
+	// Analyze the ELF shared libraries of every ABI
+	nativeLibraries, err := analyzeNativeLibraries(archive, &files, true)
+	if err != nil {
+		// Log the error but don't fail the analysis
+		fmt.Printf("Warning: failed to analyze native libraries: %v\n", err)
+	} else {
+		checkPageSizeCompliance(nativeLibraries, manifest.Application.ExtractNativeLibs != "false")
+		bundle.NativeLibraries = nativeLibraries
+		bundle.NativeAbis = summarizeNativeAbis(nativeLibraries)
+	}
+
+	// Parse resources.arsc and attribute the res/ files to their resources
+	resourceTable, err := analyzeResourceTable(archive, &files)
+	if err != nil {
+		// Log the error but don't fail the analysis
+		fmt.Printf("Warning: failed to analyze resources: %v\n", err)
+	} else if resourceTable != nil {
+		bundle.ResourceTables = []ResourceTable{*resourceTable}
+		bundle.Resources = summarizeResources(bundle.ResourceTables)
+	}
+
 	// Calculate sizes
 	bundle.InstallSize = files.Size
 
@@ -77,67 +100,155 @@ func analyzeApk(apkPath string) (*AppBundle, error) {
 	return bundle, nil
 }
 
-func analyzeAab(aabPath string) (string, error) {
-	tempDir, err := os.MkdirTemp("", "*")
+func analyzeAab(aabPath string, options Options) (*AppBundle, error) {
+	bundle := &AppBundle{}
+
+	// Analyze the AAB in place
+	archive, err := openArchive(aabPath, options.ArchiveLimits, options.Workspace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open AAB: %w", err)
+	}
+	defer archive.Close()
+
+	// The base module's manifest is stored in aapt2's protobuf format
+	manifestData, err := fs.ReadFile(archive, "base/manifest/AndroidManifest.xml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read AndroidManifest.xml: %v", err)
+	}
+	manifest, err := parseBundleManifest(manifestData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse AndroidManifest.xml: %v", err)
+	}
+	setManifestMetadata(bundle, manifest)
+
+	// Analyze the bundle files and mark its modules
+	files, err := AnalyzeFile(archive, ".")
+	if err != nil {
+		return nil, err
+	}
+	setArchiveCompressedSizes(&files, archive)
+	bundle.Modules, err = markBundleModules(&files, archive)
+	if err != nil {
+		return nil, err
+	}
+	bundle.Files = files
+
+	// Parse the resources.pb of every module and attribute the res/ files to their resources
+	for _, module := range bundle.Modules {
+		resourceTable, err := analyzeProtoResourceTable(archive, &files, module.Name)
+		if err != nil {
+			// Log the error but don't fail the analysis
+			fmt.Printf("Warning: failed to analyze resources of module %s: %v\n", module.Name, err)
+		} else if resourceTable != nil {
+			bundle.ResourceTables = append(bundle.ResourceTables, *resourceTable)
+		}
+	}
+	if len(bundle.ResourceTables) > 0 {
+		bundle.Resources = summarizeResources(bundle.ResourceTables)
+	}
+
+	// Analyze DEX files of every module
+	dexPackages, err := analyzeDexFiles(archive, options.mapping)
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp dir: %v", err)
+		// Log the error but don't fail the analysis
+		fmt.Printf("Warning: failed to analyze DEX files: %v\n", err)
+	} else {
+		bundle.DexPackages = dexPackages
 	}
-	defer os.RemoveAll(tempDir)
 
-	// Create a debug keystore if it doesn't exist
-	keystorePath := filepath.Join(tempDir, "debug.keystore")
-	if err := createDebugKeystore(keystorePath); err != nil {
-		return "", fmt.Errorf("failed to create debug keystore: %v", err)
+	// Analyze the ELF shared libraries of every ABI, where they end up in the generated APKs is up to bundletool
+	nativeLibraries, err := analyzeNativeLibraries(archive, &files, false)
+	if err != nil {
+		// Log the error but don't fail the analysis
+		fmt.Printf("Warning: failed to analyze native libraries: %v\n", err)
+	} else {
+		// bundletool aligns the libraries of the APKs it generates, only the ELF alignment is up to the app
+		checkPageSizeCompliance(nativeLibraries, true)
+		bundle.NativeLibraries = nativeLibraries
+		bundle.NativeAbis = summarizeNativeAbis(nativeLibraries)
 	}
 
-	// Convert AAB to universal APK
-	universalApkPath := filepath.Join(tempDir, "universal.apk")
-	apkPath, err := generateUniversalApk(aabPath, universalApkPath, keystorePath)
+	// Estimate the sizes of the split APKs served to each device
+	specs, err := deviceSpecs(options.DeviceSpecPaths)
+	if err != nil {
+		return nil, err
+	}
+	bundle.SizeEstimates, err = estimateDeviceSizes(archive, bundle.Modules, bundle.ResourceTables, specs)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate universal APK: %v", err)
+		return nil, fmt.Errorf("failed to estimate device sizes: %v", err)
 	}
 
-	return apkPath, nil
+	// No device downloads the whole bundle, report the largest configuration
+	bundle.DownloadSize = bundle.SizeEstimates.MaxDownloadSize
+	bundle.InstallSize = bundle.SizeEstimates.MaxInstallSize
+
+	return bundle, nil
 }
 
-func createDebugKeystore(keystorePath string) error {
-	// Create a debug keystore for signing
-	cmd := exec.Command("keytool", "-genkeypair",
-		"-keystore", keystorePath,
-		"-alias", "debug",
-		"-keyalg", "RSA",
-		"-keysize", "2048",
-		"-validity", "10000",
-		"-dname", "CN=Debug,OU=Development,O=Bitrise,L=Debug,S=Debug,C=US",
-		"-storepass", "android",
-		"-keypass", "android")
+// markBundleModules sets the type of the module and bundle config nodes at
+// the top level of an app bundle and returns the modules it found
+func markBundleModules(files *FileInfo, fsys fs.FS) ([]BundleModule, error) {
+	modules := []BundleModule{}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to create debug keystore: %v", err)
+	for i := range files.Children {
+		child := &files.Children[i]
+
+		if child.Type != "directory" {
+			if child.RelativePath == "BundleConfig.pb" {
+				child.Type = "bundle_config"
+			}
+			continue
+		}
+
+		// Every module carries its own protobuf manifest
+		manifestPath := path.Join(child.RelativePath, "manifest", "AndroidManifest.xml")
+		manifestData, err := fs.ReadFile(fsys, manifestPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read module manifest: %v", err)
+		}
+		manifest, err := parseBundleManifest(manifestData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse manifest of module %s: %v", child.RelativePath, err)
+		}
+
+		module := BundleModule{
+			Name:     child.RelativePath,
+			Type:     "feature",
+			Delivery: manifest.Module.DeliveryType(),
+			Size:     child.Size,
+		}
+		if module.Name == "base" {
+			module.Type = "base"
+		} else if manifest.Module != nil && manifest.Module.Type == "asset-pack" {
+			module.Type = "asset_pack"
+		}
+
+		child.Type = "module"
+		if module.Type == "asset_pack" {
+			child.Type = "asset_pack"
+		}
+		modules = append(modules, module)
 	}
 
-	return nil
+	return modules, nil
 }
 
-func generateUniversalApk(aabPath, outputPath, keystorePath string) (string, error) {
-	// Generate universal APK from AAB
-	cmd := exec.Command("bundletool",
-		"build-apks",
-		"--bundle="+aabPath,
-		"--output="+outputPath+".apks",
-		"--mode=universal",
-		"--ks="+keystorePath,
-		"--ks-pass=pass:android",
-		"--ks-key-alias=debug",
-		"--key-pass=pass:android")
+// setManifestMetadata fills the bundle's basic information from the manifest
+func setManifestMetadata(bundle *AppBundle, manifest *AndroidManifest) {
+	bundle.AndroidManifest = manifest
+	bundle.BundleID = manifest.Package
+	bundle.Version = manifest.VersionName + " (" + manifest.VersionCode + ")"
+	bundle.SupportedPlatforms = []string{"Android"}
 
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("failed to generate universal APK: %v", err)
+	// Unresolved resource references can't be shown as a name
+	bundle.AppName = manifest.Application.Label
+	if bundle.AppName == "" || strings.HasPrefix(bundle.AppName, "@") {
+		bundle.AppName = manifest.Package
 	}
 
-	apkPath, err := unzip(outputPath + ".apks")
-	if err != nil {
-		return "", fmt.Errorf("failed to unzip .apks file: %v", err)
+	if manifest.UsesSdk.MinSdkVersion != "" {
+		bundle.MinimumOSVersion = "API " + manifest.UsesSdk.MinSdkVersion
 	}
-	return filepath.Join(apkPath, "universal.apk"), nil
 }
@@ -3,69 +3,127 @@ package analyzer
 import (
 	"encoding/xml"
 	"fmt"
-	"os"
-	"os/exec"
-	"path/filepath"
+	"io/fs"
 	"strings"
 )
 
 type AndroidManifest struct {
-	XMLName     xml.Name `xml:"manifest"`
-	Package     string   `xml:"package,attr"`
-	VersionCode string   `xml:"versionCode,attr"`
-	VersionName string   `xml:"versionName,attr"`
+	XMLName     xml.Name             `xml:"manifest" json:"-"`
+	Package     string               `xml:"package,attr" json:"package"`
+	VersionCode string               `xml:"versionCode,attr" json:"version_code"`
+	VersionName string               `xml:"versionName,attr" json:"version_name"`
+	UsesSdk     ManifestUsesSdk      `xml:"uses-sdk" json:"uses_sdk"`
+	Permissions []ManifestPermission `xml:"uses-permission" json:"permissions,omitempty"`
+	Module      *ManifestDistModule  `xml:"module" json:"module,omitempty"`
 	Application struct {
-		Label string `xml:"label,attr"`
-	} `xml:"application"`
+		Label      string              `xml:"label,attr" json:"label"`
+		Activities []ManifestComponent `xml:"activity" json:"activities,omitempty"`
+		Services   []ManifestComponent `xml:"service" json:"services,omitempty"`
+		Receivers  []ManifestComponent `xml:"receiver" json:"receivers,omitempty"`
+		Providers  []ManifestComponent `xml:"provider" json:"providers,omitempty"`
+
+		// ExtractNativeLibs is "false" when native libraries are loaded straight from the APK
+		ExtractNativeLibs string `xml:"extractNativeLibs,attr" json:"extract_native_libs,omitempty"`
+	} `xml:"application" json:"application"`
+
+	// Split and ConfigForSplit are only set in the manifests of split APKs
+	Split          string `xml:"split,attr" json:"split,omitempty"`
+	ConfigForSplit string `xml:"configForSplit,attr" json:"config_for_split,omitempty"`
 }
 
-func parseAndroidManifest(apkPath string) (*AndroidManifest, error) {
-	// Path to the apkanalyzer tool
-	apkanalyzerPath := filepath.Join(os.Getenv("HOME"), "Library/Android/sdk/cmdline-tools/latest/bin/apkanalyzer")
+// ManifestUsesSdk represents the <uses-sdk> element of the manifest
+type ManifestUsesSdk struct {
+	MinSdkVersion    string `xml:"minSdkVersion,attr" json:"min_sdk_version,omitempty"`
+	TargetSdkVersion string `xml:"targetSdkVersion,attr" json:"target_sdk_version,omitempty"`
+}
 
-	// Check if apkanalyzer exists
-	if _, err := os.Stat(apkanalyzerPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("apkanalyzer not found at %s", apkanalyzerPath)
+// ManifestDistModule represents the <dist:module> element of app bundle modules
+type ManifestDistModule struct {
+	Type     string `xml:"type,attr" json:"type,omitempty"`
+	Title    string `xml:"title,attr" json:"title,omitempty"`
+	OnDemand string `xml:"onDemand,attr" json:"on_demand,omitempty"`
+	Delivery struct {
+		InstallTime *struct{} `xml:"install-time" json:"install_time,omitempty"`
+		FastFollow  *struct{} `xml:"fast-follow" json:"fast_follow,omitempty"`
+		OnDemand    *struct{} `xml:"on-demand" json:"on_demand,omitempty"`
+	} `xml:"delivery" json:"delivery"`
+}
+
+// DeliveryType returns how the module is delivered to devices
+func (m *ManifestDistModule) DeliveryType() string {
+	switch {
+	case m == nil:
+		return "install-time"
+	case m.Delivery.InstallTime != nil:
+		return "install-time"
+	case m.Delivery.FastFollow != nil:
+		return "fast-follow"
+	case m.Delivery.OnDemand != nil, m.OnDemand == "true":
+		return "on-demand"
 	}
+	return "install-time"
+}
+
+// ManifestPermission represents a <uses-permission> element of the manifest
+type ManifestPermission struct {
+	Name string `xml:"name,attr" json:"name"`
+}
+
+// ManifestComponent represents an activity, service, receiver or provider declared in the manifest
+type ManifestComponent struct {
+	Name     string `xml:"name,attr" json:"name"`
+	Exported string `xml:"exported,attr" json:"exported,omitempty"`
+}
 
-	// Prepare the command to extract AndroidManifest.xml
-	cmd := exec.Command(apkanalyzerPath, "manifest", "print", apkPath)
-	output, err := cmd.CombinedOutput()
+// parseAndroidManifest decodes the binary AndroidManifest.xml stored in the APK
+func parseAndroidManifest(fsys fs.FS) (*AndroidManifest, error) {
+	data, err := fs.ReadFile(fsys, "AndroidManifest.xml")
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute apkanalyzer: %v, output: %s", err, string(output))
+		return nil, err
 	}
 
-	// Parse the XML output into the AndroidManifest struct
-	var manifest AndroidManifest
-	if err := xml.Unmarshal(output, &manifest); err != nil {
-		return nil, fmt.Errorf("failed to parse AndroidManifest.xml: %v", err)
+	// Convert the binary XML to text so it can be decoded into the struct
+	output, err := decodeBinaryXML(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode binary XML: %v", err)
 	}
 
-	// If version code or name are empty, try to extract them with more specific commands
-	if manifest.VersionCode == "" || manifest.VersionName == "" {
-		// Get version code
-		cmdVersionCode := exec.Command(apkanalyzerPath, "manifest", "get-attr", "--xpath", "/manifest", "versionCode", apkPath)
-		versionCodeOutput, err := cmdVersionCode.CombinedOutput()
-		if err == nil {
-			manifest.VersionCode = strings.TrimSpace(string(versionCodeOutput))
-		}
+	return unmarshalManifest(output)
+}
 
-		// Get version name
-		cmdVersionName := exec.Command(apkanalyzerPath, "manifest", "get-attr", "--xpath", "/manifest", "versionName", apkPath)
-		versionNameOutput, err := cmdVersionName.CombinedOutput()
-		if err == nil {
-			manifest.VersionName = strings.TrimSpace(string(versionNameOutput))
-		}
+// parseBundleManifest decodes the protobuf AndroidManifest.xml of an app bundle module
+func parseBundleManifest(data []byte) (*AndroidManifest, error) {
+	output, err := decodeProtoXML(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode protobuf XML: %v", err)
 	}
 
-	// Get application label if empty
-	if manifest.Application.Label == "" {
-		cmdAppLabel := exec.Command(apkanalyzerPath, "manifest", "get-attr", "--xpath", "/manifest/application", "android:label", apkPath)
-		appLabelOutput, err := cmdAppLabel.CombinedOutput()
-		if err == nil {
-			manifest.Application.Label = strings.TrimSpace(string(appLabelOutput))
-		}
+	return unmarshalManifest(output)
+}
+
+// unmarshalManifest parses the textual manifest into the AndroidManifest struct
+func unmarshalManifest(output []byte) (*AndroidManifest, error) {
+	var manifest AndroidManifest
+	if err := xml.Unmarshal(output, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse AndroidManifest.xml: %v", err)
 	}
+	manifest.resolveComponentNames()
 
 	return &manifest, nil
 }
+
+// resolveComponentNames expands component names relative to the package, like ".MainActivity"
+func (m *AndroidManifest) resolveComponentNames() {
+	for _, components := range [][]ManifestComponent{
+		m.Application.Activities,
+		m.Application.Services,
+		m.Application.Receivers,
+		m.Application.Providers,
+	} {
+		for i := range components {
+			if strings.HasPrefix(components[i].Name, ".") {
+				components[i].Name = m.Package + components[i].Name
+			}
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package analyzer
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ApkSplit is a split APK of an .apks set, or of a directory of split APKs
+type ApkSplit struct {
+	Name   string `json:"name"`
+	Module string `json:"module"`
+	// Type is "master", "abi", "screen_density", "language", "standalone" or "universal"
+	Type   string `json:"type"`
+	Config string `json:"config,omitempty"`
+	// Delivery is the delivery type of the module the split belongs to
+	Delivery     string `json:"delivery"`
+	DownloadSize int64  `json:"download_size"`
+	InstallSize  int64  `json:"install_size"`
+}
+
+// splitAbis are the ABIs as they appear in the names of ABI config splits
+var splitAbis = map[string]bool{
+	"armeabi":     true,
+	"armeabi_v7a": true,
+	"arm64_v8a":   true,
+	"x86":         true,
+	"x86_64":      true,
+	"mips":        true,
+	"mips64":      true,
+	"riscv64":     true,
+}
+
+// openSplitFunc opens a split APK of the set by its path
+type openSplitFunc func(name string) (*archiveFS, error)
+
+// analyzeApks analyzes every split APK of a bundletool .apks set in place
+func analyzeApks(apksPath string, options Options) (*AppBundle, error) {
+	archive, err := openArchive(apksPath, options.ArchiveLimits, options.Workspace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open APKS: %w", err)
+	}
+	defer archive.Close()
+
+	return analyzeSplitSet(archive, archive.openNestedArchive, options.mapping)
+}
+
+// analyzeSplitDirectory analyzes the split APKs stored in a directory, as pulled from a device
+func analyzeSplitDirectory(dirPath string, options Options) (*AppBundle, error) {
+	return analyzeSplitSet(os.DirFS(dirPath), func(name string) (*archiveFS, error) {
+		return openArchive(filepath.Join(dirPath, filepath.FromSlash(name)), options.ArchiveLimits, options.Workspace)
+	}, options.mapping)
+}
+
+// isSplitDirectory reports whether the directory holds APKs at its top level
+func isSplitDirectory(dirPath string) bool {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.ToLower(filepath.Ext(entry.Name())) == ApkExtension {
+			return true
+		}
+	}
+	return false
+}
+
+// analyzeSplitSet analyzes every APK of the set, the file tree combines the contents of all splits
+// under the node of their APK, and the sizes are those of the largest configuration a device gets
+func analyzeSplitSet(fsys fs.FS, openSplit openSplitFunc, mapping *proguardMapping) (*AppBundle, error) {
+	bundle := &AppBundle{}
+
+	files, err := AnalyzeFile(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	if archive, ok := fsys.(*archiveFS); ok {
+		setArchiveCompressedSizes(&files, archive)
+	}
+
+	apkNodes := findApkNodes(&files)
+	if len(apkNodes) == 0 {
+		return nil, fmt.Errorf("no APK found in the split set")
+	}
+
+	var masterManifest, fallbackManifest *AndroidManifest
+	deliveries := make(map[string]string)
+	for _, node := range apkNodes {
+		split, manifest, err := analyzeSplit(node, openSplit, mapping, bundle)
+		if err != nil {
+			return nil, err
+		}
+
+		if split.Type == "master" {
+			deliveries[split.Module] = manifest.Module.DeliveryType()
+			if split.Module == "base" {
+				masterManifest = manifest
+			}
+		}
+		if fallbackManifest == nil {
+			fallbackManifest = manifest
+		}
+		bundle.Splits = append(bundle.Splits, split)
+	}
+
+	// Standalone and universal APKs carry the whole app, like the base master
+	if masterManifest == nil {
+		masterManifest = fallbackManifest
+	}
+	setManifestMetadata(bundle, masterManifest)
+
+	for i := range bundle.Splits {
+		bundle.Splits[i].Delivery = "install-time"
+		if delivery, ok := deliveries[bundle.Splits[i].Module]; ok {
+			bundle.Splits[i].Delivery = delivery
+		}
+	}
+
+	sumDirectorySizes(&files)
+	bundle.Files = files
+	checkPageSizeCompliance(bundle.NativeLibraries, masterManifest.Application.ExtractNativeLibs != "false")
+	bundle.NativeAbis = summarizeNativeAbis(bundle.NativeLibraries)
+	if len(bundle.ResourceTables) > 0 {
+		bundle.Resources = summarizeResources(bundle.ResourceTables)
+	}
+	bundle.DownloadSize, bundle.InstallSize = splitSetSizes(bundle.Splits)
+
+	return bundle, nil
+}
+
+// analyzeSplit analyzes a single APK of the set and replaces its leaf node with the tree of its contents
+func analyzeSplit(node *FileInfo, openSplit openSplitFunc, mapping *proguardMapping, bundle *AppBundle) (ApkSplit, *AndroidManifest, error) {
+	archive, err := openSplit(node.RelativePath)
+	if err != nil {
+		return ApkSplit{}, nil, fmt.Errorf("failed to open %s: %w", node.RelativePath, err)
+	}
+	defer archive.Close()
+
+	manifest, err := parseAndroidManifest(archive)
+	if err != nil {
+		return ApkSplit{}, nil, fmt.Errorf("failed to parse AndroidManifest.xml of %s: %v", node.RelativePath, err)
+	}
+
+	splitFiles, err := AnalyzeFile(archive, ".")
+	if err != nil {
+		return ApkSplit{}, nil, err
+	}
+	setArchiveCompressedSizes(&splitFiles, archive)
+
+	nativeLibraries, err := analyzeNativeLibraries(archive, &splitFiles, true)
+	if err != nil {
+		// Log the error but don't fail the analysis
+		fmt.Printf("Warning: failed to analyze native libraries of %s: %v\n", node.RelativePath, err)
+	}
+	for _, library := range nativeLibraries {
+		library.Path = path.Join(node.RelativePath, library.Path)
+		bundle.NativeLibraries = append(bundle.NativeLibraries, library)
+	}
+
+	resourceTable, err := analyzeResourceTable(archive, &splitFiles)
+	if err != nil {
+		// Log the error but don't fail the analysis
+		fmt.Printf("Warning: failed to analyze resources of %s: %v\n", node.RelativePath, err)
+	} else if resourceTable != nil {
+		resourceTable.Path = path.Join(node.RelativePath, resourceTable.Path)
+		bundle.ResourceTables = append(bundle.ResourceTables, *resourceTable)
+	}
+
+	prefixFileInfo(&splitFiles, node.RelativePath)
+
+	dexPackages, err := analyzeDexFiles(archive, mapping)
+	if err != nil {
+		// Log the error but don't fail the analysis
+		fmt.Printf("Warning: failed to analyze DEX files of %s: %v\n", node.RelativePath, err)
+	} else {
+		for i := range dexPackages {
+			dexPackages[i].DexFile = path.Join(node.RelativePath, dexPackages[i].DexFile)
+		}
+		bundle.DexPackages = append(bundle.DexPackages, dexPackages...)
+	}
+
+	split := ApkSplit{
+		Name:         node.RelativePath,
+		DownloadSize: node.Size,
+		InstallSize:  splitFiles.Size,
+	}
+	split.Module, split.Type, split.Config = splitTargeting(node.RelativePath, manifest)
+
+	// The APK is downloaded as it is, its contents are what gets installed
+	node.Type = "split_apk"
+	node.CompressedSize = node.Size
+	node.Size = splitFiles.Size
+	node.Children = splitFiles.Children
+
+	return split, manifest, nil
+}
+
+// splitTargeting returns the module, type and config of a split from its manifest,
+// like split="config.arm64_v8a" for the base module or split="feature.config.xxhdpi"
+func splitTargeting(name string, manifest *AndroidManifest) (string, string, string) {
+	if manifest.Split == "" {
+		switch {
+		case strings.HasPrefix(name, "standalones/"):
+			return "base", "standalone", ""
+		case path.Base(name) == "universal.apk":
+			return "base", "universal", ""
+		}
+		return "base", "master", ""
+	}
+
+	var module, config string
+	if c, ok := strings.CutPrefix(manifest.Split, "config."); ok {
+		module, config = "base", c
+	} else if m, c, ok := strings.Cut(manifest.Split, ".config."); ok {
+		module, config = m, c
+	} else {
+		return manifest.Split, "master", ""
+	}
+	if manifest.ConfigForSplit != "" {
+		module = manifest.ConfigForSplit
+	}
+
+	switch {
+	case splitAbis[config]:
+		return module, "abi", config
+	case densityDPI(config) > 0 || config == "nodpi" || config == "anydpi":
+		return module, "screen_density", config
+	}
+	return module, "language", config
+}
+
+// splitSetSizes returns the download and install size of the largest configuration of the set,
+// the masters of the install-time modules along with their largest split of every dimension
+func splitSetSizes(splits []ApkSplit) (int64, int64) {
+	var downloadSize, installSize int64
+	var maxStandaloneDownload, maxStandaloneInstall int64
+	hasMaster := false
+	largest := make(map[string]ApkSplit)
+
+	for _, split := range splits {
+		switch {
+		case split.Type == "standalone" || split.Type == "universal":
+			maxStandaloneDownload = max(maxStandaloneDownload, split.DownloadSize)
+			maxStandaloneInstall = max(maxStandaloneInstall, split.InstallSize)
+		case split.Delivery != "install-time":
+			continue
+		case split.Type == "master":
+			hasMaster = true
+			downloadSize += split.DownloadSize
+			installSize += split.InstallSize
+		default:
+			key := split.Module + "/" + split.Type
+			if split.DownloadSize > largest[key].DownloadSize {
+				largest[key] = split
+			}
+		}
+	}
+
+	// Devices that can't install splits get a standalone APK
+	if !hasMaster {
+		return maxStandaloneDownload, maxStandaloneInstall
+	}
+
+	for _, split := range largest {
+		downloadSize += split.DownloadSize
+		installSize += split.InstallSize
+	}
+	return downloadSize, installSize
+}
+
+// findApkNodes returns the APK files of the tree
+func findApkNodes(root *FileInfo) []*FileInfo {
+	if root.Type != "directory" {
+		if strings.ToLower(path.Ext(root.RelativePath)) == ApkExtension {
+			return []*FileInfo{root}
+		}
+		return nil
+	}
+
+	var nodes []*FileInfo
+	for i := range root.Children {
+		nodes = append(nodes, findApkNodes(&root.Children[i])...)
+	}
+	return nodes
+}
+
+// sumDirectorySizes recomputes the sizes of the directories once APK nodes were replaced by their contents
+func sumDirectorySizes(root *FileInfo) {
+	if root.Type != "directory" {
+		return
+	}
+
+	root.Size = 0
+	root.CompressedSize = 0
+	for i := range root.Children {
+		child := &root.Children[i]
+		sumDirectorySizes(child)
+		root.Size += child.Size
+		root.CompressedSize += child.CompressedSize
+	}
+}
+
+// prefixFileInfo moves the tree under prefix, so the contents of nested archives keep unique paths
+func prefixFileInfo(root *FileInfo, prefix string) {
+	root.RelativePath = path.Join(prefix, root.RelativePath)
+	for i := range root.Children {
+		prefixFileInfo(&root.Children[i], prefix)
+	}
+}
@@ -2,161 +2,318 @@ package analyzer
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
-	"strconv"
 	"strings"
 )
 
 // AppBundle represents an analyzed application bundle
 type AppBundle struct {
-	DownloadSize       int64         `json:"download_size"`
-	InstallSize        int64         `json:"install_size"`
-	BundleID           string        `json:"bundle_id"`
-	SupportedPlatforms []string      `json:"supported_platforms"`
-	Version            string        `json:"version"`
-	MinimumOSVersion   string        `json:"minimum_os_version"`
-	AppName            string        `json:"app_name"`
-	Files              FileInfo      `json:"files"`
-	CarFiles           []CarFileInfo `json:"car_files,omitempty"`
-	MachOFiles         []MachOInfo   `json:"mach_o_files,omitempty"`
-	DexPackages        []DexPackage  `json:"dex_files,omitempty"`
+	DownloadSize       int64            `json:"download_size"`
+	InstallSize        int64            `json:"install_size"`
+	LogicalInstallSize int64            `json:"logical_install_size,omitempty"`
+	BundleID           string           `json:"bundle_id"`
+	SupportedPlatforms []string         `json:"supported_platforms"`
+	Version            string           `json:"version"`
+	MinimumOSVersion   string           `json:"minimum_os_version"`
+	AppName            string           `json:"app_name"`
+	Files              FileInfo         `json:"files"`
+	CarFiles           []CarFileInfo    `json:"car_files,omitempty"`
+	MachOFiles         []MachOInfo      `json:"mach_o_files,omitempty"`
+	DexPackages        []DexPackage     `json:"dex_files,omitempty"`
+	AndroidManifest    *AndroidManifest `json:"android_manifest,omitempty"`
+	Modules            []BundleModule   `json:"modules,omitempty"`
+	SizeEstimates      *SizeEstimates   `json:"size_estimates,omitempty"`
+	Variants           []ThinnedVariant `json:"variants,omitempty"`
+	Xcarchive          *XcarchiveInfo   `json:"xcarchive,omitempty"`
+	ChildBundles       []ChildBundle    `json:"child_bundles,omitempty"`
+
+	// Slices of an XCFramework, one per platform it is built for
+	Slices []XCFrameworkSlice `json:"slices,omitempty"`
+
+	// Splits of an .apks set, or of a directory of split APKs
+	Splits []ApkSplit `json:"splits,omitempty"`
+
+	// CodeAttribution breaks the code of every Mach-O binary down by module, type and class
+	CodeAttribution []CodeAttribution `json:"code_attribution,omitempty"`
+
+	// Native libraries of Android apps, and their totals per ABI
+	NativeLibraries []NativeLibrary `json:"native_libraries,omitempty"`
+	NativeAbis      []NativeAbi     `json:"native_abis,omitempty"`
+
+	// Resource tables of Android apps, and their values by type and configuration
+	ResourceTables []ResourceTable    `json:"resource_tables,omitempty"`
+	Resources      *ResourceBreakdown `json:"resources,omitempty"`
 }
 
-// AnalyzeAppBundle analyzes the provided app bundle directory and returns the analysis results
-func AnalyzeAppBundle(bundlePath string) (*AppBundle, error) {
+// BundleModule represents a base, feature or asset pack module of an Android App Bundle
+type BundleModule struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Delivery string `json:"delivery"`
+	Size     int64  `json:"size"`
+}
+
+// AnalyzeAppBundle analyzes the app bundle named appName at the root of fsys and returns the analysis results,
+// archivePath is the IPA the bundle is read from, or empty for unpacked bundles
+func AnalyzeAppBundle(fsys fs.FS, appName string, archivePath string, options Options) (*AppBundle, error) {
 	bundle := &AppBundle{}
 
 	// Analyze the files in the bundle
-	files, err := AnalyzeFile(bundlePath, bundlePath)
+	files, err := AnalyzeFile(fsys, ".")
 	if err != nil {
 		return nil, err
 	}
 
-	bundle.AppName = filepath.Base(bundlePath)
+	bundle.AppName = appName
 	bundle.Files = files
 
-	// Calculate download size
-	bundle.DownloadSize, err = calculateDownloadSize(bundlePath)
-	if err != nil {
-		return nil, err
+	if archive, ok := fsys.(*archiveFS); ok {
+		// Archives are downloaded as they are
+		archiveInfo, err := os.Stat(archivePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get archive size: %v", err)
+		}
+		bundle.DownloadSize = archiveInfo.Size()
+
+		setArchiveCompressedSizes(&bundle.Files, archive)
+	} else {
+		// Estimate the download size by compressing the bundle in memory
+		bundle.DownloadSize, err = estimateDownloadSize(&bundle.Files, fsys, appName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to estimate download size: %v", err)
+		}
 	}
 
-	// Calculate install size using du command
-	bundle.InstallSize, err = calculateInstallSize(bundlePath)
-	if err != nil {
-		return nil, err
+	// Files occupy whole filesystem blocks once installed
+	blockSize := options.BlockSize
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
 	}
+	bundle.LogicalInstallSize = files.Size
+	bundle.InstallSize = calculateInstallSize(files, blockSize)
 
 	// iOS app bundle
-	if strings.HasSuffix(bundlePath, ".app") {
+	if strings.HasSuffix(appName, ".app") {
 		// Analyze Info.plist
-		err = AnalyzeInfoPlist(bundlePath, bundle)
+		err = AnalyzeInfoPlist(fsys, bundle)
 		if err != nil {
 			return nil, err
 		}
 
 		// Analyze .car files if present
-		err := FindAndAnalyzeCarFiles(bundlePath, bundle)
+		err := FindAndAnalyzeCarFiles(fsys, bundle)
 		if err != nil {
 			return nil, err
 		}
 
 		// Analyze Mach-O binaries
-		err = FindAndAnalyzeMachO(bundlePath, bundle)
+		err = FindAndAnalyzeMachO(fsys, bundle)
 		if err != nil {
 			return nil, err
 		}
+
+		// Embedded app extensions, App Clips and watch apps
+		bundle.ChildBundles, err = findChildBundles(fsys, ".", &bundle.Files)
+		if err != nil {
+			return nil, err
+		}
+
+		// Estimate the App Thinning variants delivered by the App Store
+		bundle.Variants = simulateAppThinning(bundle)
+	}
+
+	// Framework shipped on its own
+	if strings.HasSuffix(appName, FrameworkExtension) {
+		if err := analyzeFrameworkBundle(fsys, bundle); err != nil {
+			return nil, err
+		}
 	}
 
 	return bundle, nil
 }
 
-func calculateDownloadSize(bundlePath string) (int64, error) {
-	tempDir, err := os.MkdirTemp("", "app-*")
-	if err != nil {
-		return 0, err
+// calculateInstallSize returns the on-device size of the files, rounding each file up to the block size
+func calculateInstallSize(file FileInfo, blockSize int64) int64 {
+	if file.Type != "directory" {
+		return (file.Size + blockSize - 1) / blockSize * blockSize
+	}
+
+	var size int64
+	for _, child := range file.Children {
+		size += calculateInstallSize(child, blockSize)
 	}
-	defer os.RemoveAll(tempDir)
+	return size
+}
 
-	// Create zip file path
-	zipPath := filepath.Join(tempDir, "app.zip")
+func FilesIncludingMetaInformation(bundle *AppBundle) (FileInfo, error) {
+	extendedFiles := bundle.Files
 
-	// Run ditto command to create zip
-	cmd := exec.Command("ditto", "-c", "-k", "--sequesterRsrc", "--keepParent", bundlePath, zipPath)
-	if err := cmd.Run(); err != nil {
-		return 0, err
+	// For each CAR file, add its assets and their renditions as children of its node
+	for _, carFile := range bundle.CarFiles {
+		assets := make([]FileInfo, 0, len(carFile.Assets))
+		for _, asset := range carFile.Assets {
+			assetPath := filepath.Join(carFile.Path, asset.Name)
+			assetInfo := FileInfo{
+				RelativePath: assetPath,
+				Type:         "image",
+				Children:     make([]FileInfo, 0),
+			}
+
+			// Add renditions as children of the asset
+			for _, rendition := range asset.RenditionInfo {
+				renditionInfo := FileInfo{
+					RelativePath: filepath.Join(assetPath, fmt.Sprintf("%s @ %dx (%s)", rendition.RenditionName, rendition.Scale, rendition.Idiom)),
+					Size:         rendition.Size,
+					Shasum:       rendition.Shasum,
+					Type:         "image",
+				}
+				assetInfo.Children = append(assetInfo.Children, renditionInfo)
+
+				assetInfo.Size += rendition.Size
+			}
+
+			assets = append(assets, assetInfo)
+		}
+
+		// The renditions get their share of the compressed size of the catalog, so it keeps its download size
+		extendedFiles = withNodeChildren(extendedFiles, carFile.Path, assets)
 	}
 
-	// Get zip file size using stat
-	cmd = exec.Command("stat", "-f%z", zipPath)
-	output, err := cmd.Output()
-	if err != nil {
-		return 0, err
+	return filesIncludingDexAndResourceTables(extendedFiles, bundle), nil
+}
+
+// filesIncludingDexAndResourceTables returns a copy of the tree where every .dex file holds its packages
+// and classes, and every resources.arsc its types and configurations, the rest of the tree is shared
+func filesIncludingDexAndResourceTables(files FileInfo, bundle *AppBundle) FileInfo {
+	dexFiles := make(map[string]bool)
+	for _, pkg := range bundle.DexPackages {
+		if pkg.DexFile != "" && !dexFiles[pkg.DexFile] {
+			dexFiles[pkg.DexFile] = true
+			files = withNodeChildren(files, pkg.DexFile, dexPackageNodes(pkg.DexFile, bundle.DexPackages))
+		}
 	}
 
-	// Parse size from stat output
-	return strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+	for _, table := range bundle.ResourceTables {
+		files = withNodeChildren(files, table.Path, resourceTableNodes(table))
+	}
+	return files
 }
 
-func calculateInstallSize(bundlePath string) (int64, error) {
-	cmd := exec.Command("sh", "-c", "du -sk "+bundlePath+" | awk '{print $1 * 1024}'")
-	output, err := cmd.Output()
-	if err != nil {
-		return 0, err
+// nestedFileNodeTypes are the types of the nodes breaking a .dex file or resource table down,
+// they stand for parts of a file rather than files of their own
+var nestedFileNodeTypes = map[string]bool{
+	"dex_package":      true,
+	"dex_class":        true,
+	"resource_strings": true,
+	"resource_type":    true,
+	"resource_config":  true,
+}
+
+// FilesExcludingDexAndResourceTables returns a copy of the tree where the .dex files and resource tables
+// are single files again, so the file rankings, type breakdown and duplicates only count real files
+func FilesExcludingDexAndResourceTables(files FileInfo) FileInfo {
+	if len(files.Children) == 0 {
+		return files
+	}
+	if nestedFileNodeTypes[files.Children[0].Type] {
+		files.Children = nil
+		return files
+	}
+
+	children := make([]FileInfo, len(files.Children))
+	for i, child := range files.Children {
+		children[i] = FilesExcludingDexAndResourceTables(child)
 	}
-	return strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+	files.Children = children
+	return files
 }
 
-func FilesIncludingMetaInformation(bundle *AppBundle) (FileInfo, error) {
-	extendedFiles := bundle.Files
+// FilesIncludingMachOSegments returns a copy of the tree where every Mach-O binary holds its
+// architecture slices, segments and sections as children, the rest of the tree is shared
+func FilesIncludingMachOSegments(files FileInfo, bundle *AppBundle) FileInfo {
+	for _, machO := range bundle.MachOFiles {
+		files = addMachOSegments(files, machO)
+	}
+	return files
+}
 
-	// For each CAR file, find matching file in extendedFiles and add asset info as children
-	for _, carFile := range bundle.CarFiles {
-		// Find matching file path in extendedFiles tree
-		var findAndAddAssets func(files *FileInfo) bool
-		findAndAddAssets = func(files *FileInfo) bool {
-			if files.RelativePath == carFile.Path {
-
-				// Add each asset as a child
-				for _, asset := range carFile.Assets {
-					assetPath := filepath.Join(carFile.Path, asset.Name)
-					assetInfo := FileInfo{
-						RelativePath: assetPath,
-						Type:         "image",
-						Children:     make([]FileInfo, 0),
-					}
-
-					// Add renditions as children of the asset
-					for _, rendition := range asset.RenditionInfo {
-						renditionInfo := FileInfo{
-							RelativePath: filepath.Join(assetPath, fmt.Sprintf("%s @ %dx (%s)", rendition.RenditionName, rendition.Scale, rendition.Idiom)),
-							Size:         rendition.Size,
-							Shasum:       rendition.Shasum,
-							Type:         "image",
-						}
-						assetInfo.Children = append(assetInfo.Children, renditionInfo)
-
-						assetInfo.Size += rendition.Size
-					}
-
-					files.Children = append(files.Children, assetInfo)
-				}
-				return true
-			}
+// addMachOSegments replaces the children of the node of the binary with its slices, segments and sections
+func addMachOSegments(node FileInfo, machO MachOInfo) FileInfo {
+	return withNodeChildren(node, machO.Path, machOSegmentNodes(machO.Path, machO))
+}
 
-			// Recursively search children
-			for i := range files.Children {
-				if findAndAddAssets(&files.Children[i]) {
-					return true
-				}
+// withNodeChildren copies the nodes on the path to nodePath and replaces the children of its node,
+// the children get the share of the compressed size of the node their size stands for
+func withNodeChildren(node FileInfo, nodePath string, children []FileInfo) FileInfo {
+	if node.RelativePath == nodePath {
+		setProportionalCompressedSizes(children, node.Size, node.CompressedSize)
+		node.Children = children
+		return node
+	}
+
+	for i, child := range node.Children {
+		if child.RelativePath == nodePath || strings.HasPrefix(nodePath, child.RelativePath+"/") {
+			copied := make([]FileInfo, len(node.Children))
+			copy(copied, node.Children)
+			copied[i] = withNodeChildren(child, nodePath, children)
+			node.Children = copied
+			break
+		}
+	}
+	return node
+}
+
+// setProportionalCompressedSizes sets the compressed size of the nodes and their children
+// in the ratio of the compressed size of the file they are part of
+func setProportionalCompressedSizes(nodes []FileInfo, size int64, compressedSize int64) {
+	if size <= 0 {
+		return
+	}
+	for i := range nodes {
+		nodes[i].CompressedSize = nodes[i].Size * compressedSize / size
+		setProportionalCompressedSizes(nodes[i].Children, size, compressedSize)
+	}
+}
+
+// machOSegmentNodes returns the nodes of the segments of a thin binary, or of the slices of a fat one
+func machOSegmentNodes(binaryPath string, machO MachOInfo) []FileInfo {
+	segmentNodes := func(parent string, segments []MachOSegment) []FileInfo {
+		nodes := make([]FileInfo, 0, len(segments))
+		for _, segment := range segments {
+			segmentPath := path.Join(parent, segment.Name)
+			segmentNode := FileInfo{
+				RelativePath: segmentPath,
+				Size:         segment.Size,
+				Type:         "mach_o_segment",
+			}
+			for _, section := range segment.Sections {
+				segmentNode.Children = append(segmentNode.Children, FileInfo{
+					RelativePath: path.Join(segmentPath, section.Name),
+					Size:         section.Size,
+					Type:         "mach_o_section",
+				})
 			}
-			return false
+			nodes = append(nodes, segmentNode)
 		}
+		return nodes
+	}
 
-		findAndAddAssets(&extendedFiles)
+	if len(machO.Architecture) == 1 {
+		return segmentNodes(binaryPath, machO.Segments[machO.Architecture[0]])
 	}
 
-	return extendedFiles, nil
+	nodes := make([]FileInfo, 0, len(machO.Architecture))
+	for _, arch := range machO.Architecture {
+		slicePath := path.Join(binaryPath, arch)
+		nodes = append(nodes, FileInfo{
+			RelativePath: slicePath,
+			Size:         machO.SliceSizes[arch],
+			Type:         "mach_o_slice",
+			Children:     segmentNodes(slicePath, machO.Segments[arch]),
+		})
+	}
+	return nodes
 }
@@ -0,0 +1,134 @@
+package analyzer
+
+// ThinnedVariant is the estimated size of the app the App Store delivers to a device family
+type ThinnedVariant struct {
+	Name         string `json:"name"`
+	Idiom        string `json:"idiom"`
+	Scale        int64  `json:"scale"`
+	Architecture string `json:"architecture,omitempty"`
+	DownloadSize int64  `json:"download_size"`
+	InstallSize  int64  `json:"install_size"`
+}
+
+// thinningTarget describes a device family the App Store thins apps for
+type thinningTarget struct {
+	name  string
+	idiom string
+	scale int64
+	// architectures in order of preference, the first one the binary ships is kept
+	architectures []string
+}
+
+var thinningTargets = []thinningTarget{
+	{name: "iPhone @2x", idiom: "phone", scale: 2, architectures: []string{"arm64", "armv7s", "armv7"}},
+	{name: "iPhone @3x", idiom: "phone", scale: 3, architectures: []string{"arm64", "armv7s", "armv7"}},
+	{name: "iPad @1x", idiom: "pad", scale: 1, architectures: []string{"armv7s", "armv7"}},
+	{name: "iPad @2x", idiom: "pad", scale: 2, architectures: []string{"arm64", "armv7s", "armv7"}},
+}
+
+// simulateAppThinning estimates the size of every App Thinning variant of the universal app,
+// by removing the architecture slices and asset catalog renditions the device doesn't use
+func simulateAppThinning(bundle *AppBundle) []ThinnedVariant {
+	variants := make([]ThinnedVariant, 0)
+	for _, target := range thinningTargets {
+		removedBinary, architecture, ok := thinnedBinarySize(bundle.MachOFiles, target)
+		if !ok {
+			continue
+		}
+		removedAssets := thinnedAssetSize(bundle.CarFiles, target)
+
+		variant := ThinnedVariant{
+			Name:         target.name,
+			Idiom:        target.idiom,
+			Scale:        target.scale,
+			Architecture: architecture,
+			InstallSize:  bundle.InstallSize - removedBinary - removedAssets,
+		}
+
+		// The variant compresses about as well as the universal app does
+		if bundle.InstallSize > 0 {
+			variant.DownloadSize = int64(float64(bundle.DownloadSize) * float64(variant.InstallSize) / float64(bundle.InstallSize))
+		}
+
+		variants = append(variants, variant)
+	}
+
+	return variants
+}
+
+// thinnedBinarySize returns the size of the slices removed from the binaries for the target,
+// the architecture delivered to it, and whether the app ships code the target can run
+func thinnedBinarySize(machOFiles []MachOInfo, target thinningTarget) (int64, string, bool) {
+	var removed int64
+	var delivered string
+	for _, machO := range machOFiles {
+		architecture := ""
+		for _, candidate := range target.architectures {
+			if _, ok := machO.SliceSizes[candidate]; ok {
+				architecture = candidate
+				break
+			}
+		}
+
+		// Binaries without a matching slice, like simulator-only helpers, are not delivered
+		if architecture == "" {
+			removed += machO.Size
+			continue
+		}
+
+		if delivered == "" {
+			delivered = architecture
+		}
+		if len(machO.SliceSizes) > 1 {
+			removed += machO.Size - machO.SliceSizes[architecture]
+		}
+	}
+
+	return removed, delivered, delivered != "" || len(machOFiles) == 0
+}
+
+// thinnedAssetSize returns the size of the asset catalog renditions the target doesn't use
+func thinnedAssetSize(carFiles []CarFileInfo, target thinningTarget) int64 {
+	var removed int64
+	for _, carFile := range carFiles {
+		for _, asset := range carFile.Assets {
+			// Device specific renditions take precedence over universal ones
+			idiom := "universal"
+			for _, rendition := range asset.RenditionInfo {
+				if rendition.Idiom == target.idiom {
+					idiom = target.idiom
+					break
+				}
+			}
+
+			scale := int64(-1)
+			for _, rendition := range asset.RenditionInfo {
+				if rendition.Idiom == idiom && isBetterScale(rendition.Scale, scale, target.scale) {
+					scale = rendition.Scale
+				}
+			}
+
+			for _, rendition := range asset.RenditionInfo {
+				if rendition.Idiom != idiom || rendition.Scale != scale {
+					removed += rendition.Size
+				}
+			}
+		}
+	}
+
+	return removed
+}
+
+// isBetterScale reports whether candidate suits the device scale better than current,
+// scale 0 renditions are resolution independent and always match
+func isBetterScale(candidate, current, device int64) bool {
+	switch {
+	case current < 0:
+		return true
+	case current == device || current == 0:
+		return false
+	case candidate == device || candidate == 0:
+		return true
+	}
+	return isBetterDensity(int(candidate), int(current), int(device))
+}
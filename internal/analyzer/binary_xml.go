@@ -0,0 +1,289 @@
+package analyzer
+
+import (
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf16"
+)
+
+// Chunk types of the compiled Android binary XML format
+const (
+	axmlStringPoolType     = 0x0001
+	axmlXMLType            = 0x0003
+	axmlStartNamespaceType = 0x0100
+	axmlEndNamespaceType   = 0x0101
+	axmlStartElementType   = 0x0102
+	axmlEndElementType     = 0x0103
+	axmlCDataType          = 0x0104
+	axmlResourceMapType    = 0x0180
+)
+
+// Typed value data types used by attributes
+const (
+	axmlTypeNull      = 0x00
+	axmlTypeReference = 0x01
+	axmlTypeAttribute = 0x02
+	axmlTypeString    = 0x03
+	axmlTypeFloat     = 0x04
+	axmlTypeDimension = 0x05
+	axmlTypeFraction  = 0x06
+	axmlTypeIntDec    = 0x10
+	axmlTypeIntHex    = 0x11
+	axmlTypeIntBool   = 0x12
+	axmlTypeColorMin  = 0x1c
+	axmlTypeColorMax  = 0x1f
+)
+
+const axmlNoEntry = 0xffffffff
+
+// androidAttributeNames resolves framework attribute resource IDs for
+// manifests whose attribute name strings were stripped by an obfuscator
+var androidAttributeNames = map[uint32]string{
+	0x01010001: "label",
+	0x01010002: "icon",
+	0x01010003: "name",
+	0x01010010: "exported",
+	0x0101020c: "minSdkVersion",
+	0x0101021b: "versionCode",
+	0x0101021c: "versionName",
+	0x01010270: "targetSdkVersion",
+	0x01010271: "maxSdkVersion",
+	0x010104ea: "extractNativeLibs",
+	0x01010572: "compileSdkVersion",
+	0x01010573: "compileSdkVersionCodename",
+}
+
+// stringPool holds the decoded strings of a ResStringPool chunk
+type stringPool []string
+
+func (p stringPool) get(index uint32) string {
+	if index == axmlNoEntry || index >= uint32(len(p)) {
+		return ""
+	}
+	return p[index]
+}
+
+// parseStringPool decodes a ResStringPool chunk, including its header
+func parseStringPool(chunk []byte) (stringPool, error) {
+	le := binary.LittleEndian
+	if len(chunk) < 28 {
+		return nil, fmt.Errorf("string pool too short")
+	}
+
+	headerSize := uint32(le.Uint16(chunk[2:4]))
+	stringCount := le.Uint32(chunk[8:12])
+	flags := le.Uint32(chunk[16:20])
+	stringsStart := le.Uint32(chunk[20:24])
+	isUTF8 := flags&(1<<8) != 0
+
+	if uint64(headerSize)+uint64(stringCount)*4 > uint64(len(chunk)) {
+		return nil, fmt.Errorf("string pool offsets out of bounds")
+	}
+
+	pool := make(stringPool, stringCount)
+	for i := uint32(0); i < stringCount; i++ {
+		offset := uint64(stringsStart) + uint64(le.Uint32(chunk[headerSize+i*4:]))
+		if offset >= uint64(len(chunk)) {
+			return nil, fmt.Errorf("string %d out of bounds", i)
+		}
+		data := chunk[offset:]
+
+		if isUTF8 {
+			// Length in characters followed by length in bytes
+			_, n := decodeUTF8Length(data)
+			byteLength, m := decodeUTF8Length(data[n:])
+			start := n + m
+			if start+byteLength > len(data) {
+				return nil, fmt.Errorf("string %d out of bounds", i)
+			}
+			pool[i] = string(data[start : start+byteLength])
+		} else {
+			length, n := decodeUTF16Length(data)
+			if n+length*2 > len(data) {
+				return nil, fmt.Errorf("string %d out of bounds", i)
+			}
+			units := make([]uint16, length)
+			for j := range units {
+				units[j] = le.Uint16(data[n+j*2:])
+			}
+			pool[i] = string(utf16.Decode(units))
+		}
+	}
+
+	return pool, nil
+}
+
+func decodeUTF8Length(data []byte) (int, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+	if data[0]&0x80 != 0 && len(data) > 1 {
+		return int(data[0]&0x7f)<<8 | int(data[1]), 2
+	}
+	return int(data[0]), 1
+}
+
+func decodeUTF16Length(data []byte) (int, int) {
+	if len(data) < 2 {
+		return 0, len(data)
+	}
+	first := binary.LittleEndian.Uint16(data)
+	if first&0x8000 != 0 && len(data) >= 4 {
+		return int(first&0x7fff)<<16 | int(binary.LittleEndian.Uint16(data[2:])), 4
+	}
+	return int(first), 2
+}
+
+// decodeBinaryXML converts a compiled Android binary XML document back to its textual form
+func decodeBinaryXML(data []byte) ([]byte, error) {
+	le := binary.LittleEndian
+	if len(data) < 8 || le.Uint16(data[0:2]) != axmlXMLType {
+		return nil, fmt.Errorf("not a binary XML document")
+	}
+
+	var (
+		out          strings.Builder
+		pool         stringPool
+		resourceIDs  []uint32
+		namespaces   = make(map[string]string)
+		pendingXmlns []string
+	)
+
+	out.WriteString(xml.Header)
+
+	offset := uint64(le.Uint16(data[2:4]))
+	for offset+8 <= uint64(len(data)) {
+		chunkType := le.Uint16(data[offset:])
+		headerSize := uint64(le.Uint16(data[offset+2:]))
+		chunkSize := uint64(le.Uint32(data[offset+4:]))
+		if chunkSize < 8 || offset+chunkSize > uint64(len(data)) {
+			return nil, fmt.Errorf("invalid chunk at offset %d", offset)
+		}
+		chunk := data[offset : offset+chunkSize]
+		offset += chunkSize
+
+		switch chunkType {
+		case axmlStringPoolType:
+			var err error
+			if pool, err = parseStringPool(chunk); err != nil {
+				return nil, err
+			}
+
+		case axmlResourceMapType:
+			for i := headerSize; i+4 <= chunkSize; i += 4 {
+				resourceIDs = append(resourceIDs, le.Uint32(chunk[i:]))
+			}
+
+		case axmlStartNamespaceType:
+			if len(chunk) < 24 {
+				continue
+			}
+			prefix := pool.get(le.Uint32(chunk[16:]))
+			uri := pool.get(le.Uint32(chunk[20:]))
+			namespaces[uri] = prefix
+			pendingXmlns = append(pendingXmlns, fmt.Sprintf(" xmlns:%s=\"%s\"", prefix, escapeXML(uri)))
+
+		case axmlStartElementType:
+			if len(chunk) < 36 {
+				return nil, fmt.Errorf("start element chunk too short")
+			}
+			name := pool.get(le.Uint32(chunk[20:]))
+			attributeStart := uint64(le.Uint16(chunk[24:]))
+			attributeSize := uint64(le.Uint16(chunk[26:]))
+			attributeCount := uint64(le.Uint16(chunk[28:]))
+
+			out.WriteString("<" + name)
+			for _, xmlns := range pendingXmlns {
+				out.WriteString(xmlns)
+			}
+			pendingXmlns = nil
+
+			for i := uint64(0); i < attributeCount; i++ {
+				attrOffset := 16 + attributeStart + i*attributeSize
+				if attrOffset+20 > chunkSize {
+					break
+				}
+				attr := chunk[attrOffset:]
+				nameIndex := le.Uint32(attr[4:])
+
+				attrName := pool.get(nameIndex)
+				if nameIndex < uint32(len(resourceIDs)) {
+					if resolved, ok := androidAttributeNames[resourceIDs[nameIndex]]; ok && attrName == "" {
+						attrName = resolved
+					}
+				}
+				if attrName == "" {
+					continue
+				}
+				if prefix := namespaces[pool.get(le.Uint32(attr[0:]))]; prefix != "" {
+					attrName = prefix + ":" + attrName
+				}
+
+				value := formatTypedValue(pool, le.Uint32(attr[8:]), attr[15], le.Uint32(attr[16:]))
+				out.WriteString(fmt.Sprintf(" %s=\"%s\"", attrName, escapeXML(value)))
+			}
+			out.WriteString(">")
+
+		case axmlEndElementType:
+			if len(chunk) < 24 {
+				return nil, fmt.Errorf("end element chunk too short")
+			}
+			out.WriteString("</" + pool.get(le.Uint32(chunk[20:])) + ">")
+
+		case axmlCDataType:
+			if len(chunk) < 20 {
+				continue
+			}
+			out.WriteString(escapeXML(pool.get(le.Uint32(chunk[16:]))))
+
+		case axmlEndNamespaceType:
+			// Namespaces stay in scope for the rest of the document
+		}
+	}
+
+	return []byte(out.String()), nil
+}
+
+// formatTypedValue renders an attribute value the way aapt dumps it
+func formatTypedValue(pool stringPool, rawValue uint32, dataType byte, data uint32) string {
+	if rawValue != axmlNoEntry {
+		return pool.get(rawValue)
+	}
+
+	switch {
+	case dataType == axmlTypeNull:
+		return ""
+	case dataType == axmlTypeReference:
+		return fmt.Sprintf("@0x%08x", data)
+	case dataType == axmlTypeAttribute:
+		return fmt.Sprintf("?0x%08x", data)
+	case dataType == axmlTypeString:
+		return pool.get(data)
+	case dataType == axmlTypeFloat:
+		return fmt.Sprintf("%g", math.Float32frombits(data))
+	case dataType == axmlTypeDimension, dataType == axmlTypeFraction:
+		return fmt.Sprintf("0x%08x", data)
+	case dataType == axmlTypeIntDec:
+		return fmt.Sprintf("%d", int32(data))
+	case dataType == axmlTypeIntHex:
+		return fmt.Sprintf("0x%x", data)
+	case dataType == axmlTypeIntBool:
+		if data != 0 {
+			return "true"
+		}
+		return "false"
+	case dataType >= axmlTypeColorMin && dataType <= axmlTypeColorMax:
+		return fmt.Sprintf("#%08x", data)
+	}
+
+	return fmt.Sprintf("0x%08x", data)
+}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,227 @@
+package analyzer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+const testAndroidNamespace = "http://schemas.android.com/apk/res/android"
+
+// testChunk assembles a ResChunk, header holds the fields following the type, header size and size
+func testChunk(chunkType uint16, header []byte, body []byte) []byte {
+	le := binary.LittleEndian
+	chunk := le.AppendUint16(nil, chunkType)
+	chunk = le.AppendUint16(chunk, uint16(8+len(header)))
+	chunk = le.AppendUint32(chunk, uint32(8+len(header)+len(body)))
+	chunk = append(chunk, header...)
+	return append(chunk, body...)
+}
+
+func testStringPool(utf8 bool, strs ...string) []byte {
+	le := binary.LittleEndian
+	var offsets, data []byte
+	for _, s := range strs {
+		offsets = le.AppendUint32(offsets, uint32(len(data)))
+		if utf8 {
+			data = append(data, byte(len([]rune(s))), byte(len(s)))
+			data = append(data, s...)
+			data = append(data, 0)
+		} else {
+			units := utf16.Encode([]rune(s))
+			data = le.AppendUint16(data, uint16(len(units)))
+			for _, unit := range units {
+				data = le.AppendUint16(data, unit)
+			}
+			data = le.AppendUint16(data, 0)
+		}
+	}
+
+	var flags uint32
+	if utf8 {
+		flags = 1 << 8
+	}
+	header := le.AppendUint32(nil, uint32(len(strs)))
+	header = le.AppendUint32(header, 0)
+	header = le.AppendUint32(header, flags)
+	header = le.AppendUint32(header, uint32(28+len(offsets)))
+	header = le.AppendUint32(header, 0)
+	return testChunk(axmlStringPoolType, header, append(offsets, data...))
+}
+
+// testNode assembles a node chunk, with a line number and no comment
+func testNode(chunkType uint16, fields ...uint32) []byte {
+	le := binary.LittleEndian
+	header := le.AppendUint32(nil, 1)
+	header = le.AppendUint32(header, axmlNoEntry)
+	var body []byte
+	for _, field := range fields {
+		body = le.AppendUint32(body, field)
+	}
+	return testChunk(chunkType, header, body)
+}
+
+type testAttribute struct {
+	namespace, name, rawValue uint32
+	dataType                  byte
+	data                      uint32
+}
+
+func testStartElement(name uint32, attributes ...testAttribute) []byte {
+	le := binary.LittleEndian
+	header := le.AppendUint32(nil, 1)
+	header = le.AppendUint32(header, axmlNoEntry)
+
+	body := le.AppendUint32(nil, axmlNoEntry)
+	body = le.AppendUint32(body, name)
+	body = le.AppendUint16(body, 20)
+	body = le.AppendUint16(body, 20)
+	body = le.AppendUint16(body, uint16(len(attributes)))
+	body = append(body, make([]byte, 6)...)
+	for _, attribute := range attributes {
+		body = le.AppendUint32(body, attribute.namespace)
+		body = le.AppendUint32(body, attribute.name)
+		body = le.AppendUint32(body, attribute.rawValue)
+		body = le.AppendUint16(body, 8)
+		body = append(body, 0, attribute.dataType)
+		body = le.AppendUint32(body, attribute.data)
+	}
+	return testChunk(axmlStartElementType, header, body)
+}
+
+func testBinaryXML(chunks ...[]byte) []byte {
+	var body []byte
+	for _, chunk := range chunks {
+		body = append(body, chunk...)
+	}
+	return testChunk(axmlXMLType, nil, body)
+}
+
+// testManifest is a manifest whose package is a raw string and versionCode a typed integer,
+// the name of the versionName attribute is stripped and resolved through the resource map
+func testManifest(utf8 bool) []byte {
+	const (
+		android = iota
+		uri
+		manifest
+		pkg
+		packageName
+		versionCode
+		stripped
+		versionName
+		application
+	)
+	return testBinaryXML(
+		testStringPool(utf8, "android", testAndroidNamespace, "manifest", "package", "com.example.app", "versionCode", "", "1.0 «beta»", "application"),
+		testChunk(axmlResourceMapType, nil, binary.LittleEndian.AppendUint32(make([]byte, 24), 0x0101021c)),
+		testNode(axmlStartNamespaceType, android, uri),
+		testStartElement(manifest,
+			testAttribute{axmlNoEntry, pkg, packageName, axmlTypeString, packageName},
+			testAttribute{uri, versionCode, axmlNoEntry, axmlTypeIntDec, 42},
+			testAttribute{uri, stripped, versionName, axmlTypeString, versionName},
+		),
+		testStartElement(application),
+		testNode(axmlEndElementType, axmlNoEntry, application),
+		testNode(axmlEndElementType, axmlNoEntry, manifest),
+		testNode(axmlEndNamespaceType, android, uri),
+	)
+}
+
+func TestDecodeBinaryXML(t *testing.T) {
+	want := `<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="com.example.app" ` +
+		`android:versionCode="42" android:versionName="1.0 «beta»"><application></application></manifest>`
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "UTF-16 string pool", data: testManifest(false)},
+		{name: "UTF-8 string pool", data: testManifest(true)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeBinaryXML(tt.data)
+			if err != nil {
+				t.Fatalf("decodeBinaryXML() error = %v", err)
+			}
+			if !strings.HasSuffix(string(got), want) {
+				t.Errorf("decodeBinaryXML() = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestDecodeBinaryXMLMalformed(t *testing.T) {
+	le := binary.LittleEndian
+	manifest := testManifest(false)
+	// The string pool follows the document header, the resource map follows the string pool
+	poolEnd := 8 + le.Uint32(manifest[8+4:])
+	resourceMapEnd := poolEnd + le.Uint32(manifest[poolEnd+4:])
+
+	outOfBoundsPool := testStringPool(false, "manifest")
+	le.PutUint32(outOfBoundsPool[8:], 1000)
+
+	outOfBoundsString := testStringPool(false, "manifest")
+	le.PutUint32(outOfBoundsString[28:], 1000)
+
+	shortElement := testChunk(axmlStartElementType, make([]byte, 8), make([]byte, 4))
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{name: "resource table", data: testChunk(0x0002, make([]byte, 4), nil), want: "not a binary XML document"},
+		{name: "string pool cut short", data: manifest[:poolEnd-1], want: "invalid chunk at offset 8"},
+		{name: "resource map cut short", data: manifest[:resourceMapEnd-1], want: fmt.Sprintf("invalid chunk at offset %d", poolEnd)},
+		{name: "chunk smaller than its header", data: testBinaryXML(make([]byte, 8)), want: "invalid chunk"},
+		{name: "string offsets past the end", data: testBinaryXML(outOfBoundsPool), want: "string pool offsets out of bounds"},
+		{name: "string past the end", data: testBinaryXML(outOfBoundsString), want: "string 0 out of bounds"},
+		{name: "short string pool", data: testBinaryXML(testChunk(axmlStringPoolType, nil, nil)), want: "string pool too short"},
+		{name: "short start element", data: testBinaryXML(shortElement), want: "start element chunk too short"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeBinaryXML(tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("decodeBinaryXML() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatTypedValue(t *testing.T) {
+	pool := stringPool{"raw", "typed"}
+	tests := []struct {
+		name     string
+		rawValue uint32
+		dataType byte
+		data     uint32
+		want     string
+	}{
+		{name: "raw string", rawValue: 0, dataType: axmlTypeString, data: 1, want: "raw"},
+		{name: "typed string", rawValue: axmlNoEntry, dataType: axmlTypeString, data: 1, want: "typed"},
+		{name: "string out of range", rawValue: axmlNoEntry, dataType: axmlTypeString, data: 5, want: ""},
+		{name: "null", rawValue: axmlNoEntry, dataType: axmlTypeNull, want: ""},
+		{name: "reference", rawValue: axmlNoEntry, dataType: axmlTypeReference, data: 0x7f0c0001, want: "@0x7f0c0001"},
+		{name: "attribute", rawValue: axmlNoEntry, dataType: axmlTypeAttribute, data: 0x01010036, want: "?0x01010036"},
+		{name: "float", rawValue: axmlNoEntry, dataType: axmlTypeFloat, data: math.Float32bits(1.5), want: "1.5"},
+		{name: "dimension", rawValue: axmlNoEntry, dataType: axmlTypeDimension, data: 0x1001, want: "0x00001001"},
+		{name: "negative integer", rawValue: axmlNoEntry, dataType: axmlTypeIntDec, data: 0xffffffff, want: "-1"},
+		{name: "hex integer", rawValue: axmlNoEntry, dataType: axmlTypeIntHex, data: 0x10, want: "0x10"},
+		{name: "true", rawValue: axmlNoEntry, dataType: axmlTypeIntBool, data: 0xffffffff, want: "true"},
+		{name: "false", rawValue: axmlNoEntry, dataType: axmlTypeIntBool, data: 0, want: "false"},
+		{name: "color", rawValue: axmlNoEntry, dataType: 0x1d, data: 0xff00ff00, want: "#ff00ff00"},
+		{name: "unknown type", rawValue: axmlNoEntry, dataType: 0x07, data: 3, want: "0x00000003"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatTypedValue(pool, tt.rawValue, tt.dataType, tt.data); got != tt.want {
+				t.Errorf("formatTypedValue() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
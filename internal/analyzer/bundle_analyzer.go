@@ -7,22 +7,69 @@ import (
 )
 
 const (
-	AppExtension       = ".app"
-	IpaExtension       = ".ipa"
-	XcarchiveExtension = ".xcarchive"
-	ApkExtension       = ".apk"
-	AabExtension       = ".aab"
+	AppExtension         = ".app"
+	IpaExtension         = ".ipa"
+	XcarchiveExtension   = ".xcarchive"
+	FrameworkExtension   = ".framework"
+	XcframeworkExtension = ".xcframework"
+	ApkExtension         = ".apk"
+	AabExtension         = ".aab"
+	ApksExtension        = ".apks"
 )
 
-func AnalyzeBundlePath(bundle_path string) (*AppBundle, error) {
+// DefaultBlockSize is the APFS block size used to round up install sizes
+const DefaultBlockSize = 4096
+
+// Options configures an analysis run
+type Options struct {
+	// DeviceSpecPaths are bundletool device-spec JSON files to estimate AAB sizes for
+	DeviceSpecPaths []string
+	// BlockSize is the filesystem block size every installed file is rounded up to
+	BlockSize int64
+	// ArchiveLimits guards the analysis of IPA, APK and AAB archives, unset limits use the defaults
+	ArchiveLimits ArchiveLimits
+	// LinkMapPaths are ld link maps of the binaries of iOS bundles, to attribute them to static libraries
+	LinkMapPaths []string
+	// Workspace holds the scratch files of the run, a temporary one is used when unset
+	Workspace *Workspace
+	// MappingPath is the R8 or ProGuard mapping.txt the DEX class names are restored with
+	MappingPath string
+
+	// mapping is the mapping read from MappingPath
+	mapping *proguardMapping
+}
+
+func AnalyzeBundlePath(bundle_path string, options Options) (*AppBundle, error) {
 	ext := strings.ToLower(filepath.Ext(bundle_path))
 
+	if options.Workspace == nil {
+		workspace, err := NewWorkspace(false)
+		if err != nil {
+			return nil, err
+		}
+		defer workspace.Cleanup()
+		options.Workspace = workspace
+	}
+
+	if options.MappingPath != "" {
+		mapping, err := loadProguardMapping(options.MappingPath)
+		if err != nil {
+			return nil, err
+		}
+		options.mapping = mapping
+	}
+
 	switch ext {
-	case AppExtension, IpaExtension, XcarchiveExtension:
-		return analyzeIOSBundle(bundle_path)
-	case ApkExtension, AabExtension:
-		return analyzeAndroidBundle(bundle_path)
+	case AppExtension, IpaExtension, XcarchiveExtension, FrameworkExtension, XcframeworkExtension:
+		return analyzeIOSBundle(bundle_path, options)
+	case ApkExtension, AabExtension, ApksExtension:
+		return analyzeAndroidBundle(bundle_path, options)
 	default:
+		// Split APKs pulled from a device come as a plain directory
+		if isSplitDirectory(bundle_path) {
+			return analyzeSplitDirectory(bundle_path, options)
+		}
+
 		return nil, fmt.Errorf("unsupported file extension: %s", ext)
 	}
 }
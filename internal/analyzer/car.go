@@ -1,11 +1,12 @@
 package analyzer
 
 import (
-	"encoding/json"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
-	"os"
-	"os/exec"
-	"path/filepath"
+	"io/fs"
+	"path"
 	"strings"
 )
 
@@ -30,114 +31,392 @@ type CarFileInfo struct {
 	Assets []AssetInfo `json:"assets"`
 }
 
-// AssetsutilCatalog represents the JSON structure returned by assetutil
-type AssetsutilCatalog struct {
-	Type          string `json:"AssetType"`
-	Name          string `json:"Name"`
-	RenditionName string `json:"RenditionName"`
-	Scale         int64  `json:"Scale"`
-	Idiom         string `json:"Idiom"`
-	SizeOnDisk    int64  `json:"SizeOnDisk"`
-	Compression   string `json:"Compression"`
-	SHA1Digest    string `json:"SHA1Digest"`
+// Rendition key attributes used by CoreUI
+const (
+	carAttributeScale      = 12
+	carAttributeIdiom      = 15
+	carAttributeIdentifier = 17
+)
+
+// csiHeaderSize is the fixed size of the CoreUI CSI header preceding every rendition
+const csiHeaderSize = 184
+
+var carIdioms = map[uint16]string{
+	0: "universal",
+	1: "phone",
+	2: "pad",
+	3: "tv",
+	4: "car",
+	5: "watch",
+	6: "marketing",
+	7: "mac",
+	8: "vision",
+}
+
+var carCompressions = map[uint32]string{
+	0:  "uncompressed",
+	1:  "rle",
+	2:  "zip",
+	3:  "lzvn",
+	4:  "lzfse",
+	5:  "jpeg-lzfse",
+	6:  "blurred",
+	7:  "astc",
+	8:  "palette-img",
+	9:  "hevc",
+	10: "deepmap-lzfse",
+	11: "deepmap2",
+}
+
+// bomStore is a minimal reader for the BOM container format used by .car files
+type bomStore struct {
+	data   []byte
+	blocks [][2]uint32
+	vars   map[string]uint32
+}
+
+func parseBOMStore(data []byte) (*bomStore, error) {
+	if len(data) < 32 || string(data[:8]) != "BOMStore" {
+		return nil, fmt.Errorf("not a BOM store")
+	}
+
+	be := binary.BigEndian
+	indexOffset := be.Uint32(data[16:20])
+	varsOffset := be.Uint32(data[24:28])
+
+	store := &bomStore{
+		data: data,
+		vars: make(map[string]uint32),
+	}
+
+	// Block table: count followed by (address, length) pairs
+	if uint64(indexOffset)+4 > uint64(len(data)) {
+		return nil, fmt.Errorf("block table out of bounds")
+	}
+	count := be.Uint32(data[indexOffset:])
+	pos := uint64(indexOffset) + 4
+	if pos+uint64(count)*8 > uint64(len(data)) {
+		return nil, fmt.Errorf("block table out of bounds")
+	}
+	store.blocks = make([][2]uint32, count)
+	for i := range store.blocks {
+		store.blocks[i][0] = be.Uint32(data[pos:])
+		store.blocks[i][1] = be.Uint32(data[pos+4:])
+		pos += 8
+	}
+
+	// Named variables: count followed by (block index, name length, name)
+	if uint64(varsOffset)+4 > uint64(len(data)) {
+		return nil, fmt.Errorf("variable table out of bounds")
+	}
+	count = be.Uint32(data[varsOffset:])
+	pos = uint64(varsOffset) + 4
+	for i := uint32(0); i < count; i++ {
+		if pos+5 > uint64(len(data)) {
+			return nil, fmt.Errorf("variable table out of bounds")
+		}
+		index := be.Uint32(data[pos:])
+		length := uint64(data[pos+4])
+		pos += 5
+		if pos+length > uint64(len(data)) {
+			return nil, fmt.Errorf("variable table out of bounds")
+		}
+		store.vars[string(data[pos:pos+length])] = index
+		pos += length
+	}
+
+	return store, nil
+}
+
+// block returns the contents of the block with the given index
+func (s *bomStore) block(index uint32) ([]byte, error) {
+	if index >= uint32(len(s.blocks)) {
+		return nil, fmt.Errorf("block %d out of range", index)
+	}
+	address, length := s.blocks[index][0], s.blocks[index][1]
+	if uint64(address)+uint64(length) > uint64(len(s.data)) {
+		return nil, fmt.Errorf("block %d out of bounds", index)
+	}
+	return s.data[address : address+length], nil
+}
+
+// namedBlock returns the contents of the block referenced by the given variable
+func (s *bomStore) namedBlock(name string) ([]byte, error) {
+	index, ok := s.vars[name]
+	if !ok {
+		return nil, fmt.Errorf("%s not found", name)
+	}
+	return s.block(index)
+}
+
+// walkTree calls fn with the key and value of every entry in the named BOM tree
+func (s *bomStore) walkTree(name string, fn func(key, value []byte) error) error {
+	be := binary.BigEndian
+
+	tree, err := s.namedBlock(name)
+	if err != nil {
+		return err
+	}
+	if len(tree) < 12 || string(tree[:4]) != "tree" {
+		return fmt.Errorf("%s is not a tree", name)
+	}
+
+	// Descend to the leftmost leaf
+	index := be.Uint32(tree[8:12])
+	paths, err := s.block(index)
+	if err != nil {
+		return err
+	}
+	for depth := 0; ; depth++ {
+		if len(paths) < 12 {
+			return fmt.Errorf("invalid tree node in %s", name)
+		}
+		if be.Uint16(paths[0:2]) != 0 {
+			break
+		}
+		if len(paths) < 20 || depth > 64 {
+			return fmt.Errorf("invalid tree node in %s", name)
+		}
+		if paths, err = s.block(be.Uint32(paths[12:16])); err != nil {
+			return err
+		}
+	}
+
+	// Follow the forward links between the leaves
+	visited := make(map[uint32]bool)
+	for {
+		count := int(be.Uint16(paths[2:4]))
+		forward := be.Uint32(paths[4:8])
+		if len(paths) < 12+count*8 {
+			return fmt.Errorf("invalid tree leaf in %s", name)
+		}
+
+		for i := 0; i < count; i++ {
+			entry := paths[12+i*8:]
+			value, err := s.block(be.Uint32(entry[0:4]))
+			if err != nil {
+				return err
+			}
+			key, err := s.block(be.Uint32(entry[4:8]))
+			if err != nil {
+				return err
+			}
+			if err := fn(key, value); err != nil {
+				return err
+			}
+		}
+
+		if forward == 0 || visited[forward] {
+			return nil
+		}
+		visited[forward] = true
+		if paths, err = s.block(forward); err != nil {
+			return err
+		}
+		if len(paths) < 12 {
+			return fmt.Errorf("invalid tree leaf in %s", name)
+		}
+	}
 }
 
 // TODO: Add "Other" for the remaining size
-// ParseCARFile uses assetutil to analyze the .car file and returns structured information
-func ParseCARFile(path string, basePath string) (*CarFileInfo, error) {
-	// Check if assetutil exists
-	if _, err := exec.LookPath("assetutil"); err != nil {
-		return nil, fmt.Errorf("assetutil not found: this tool requires macOS")
+// ParseCARFile reads the BOM/CoreUI structure of the .car file and returns structured information
+func ParseCARFile(fsys fs.FS, name string) (*CarFileInfo, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read asset catalog: %v", err)
 	}
 
-	// Run assetutil to get JSON output
-	cmd := exec.Command("assetutil", "--info", path)
-	output, err := cmd.Output()
+	store, err := parseBOMStore(data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to run assetutil: %v", err)
+		return nil, fmt.Errorf("failed to parse asset catalog: %v", err)
 	}
 
-	// Parse the JSON output into AssetsutilCatalog slice
-	var catalogs []AssetsutilCatalog
-	if err := json.Unmarshal(output, &catalogs); err != nil {
-		return nil, fmt.Errorf("failed to parse assetutil output: %v", err)
+	le := binary.LittleEndian
+
+	// The key format lists which attribute each position of a rendition key holds
+	keyFormat, err := store.namedBlock("KEYFORMAT")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key format: %v", err)
+	}
+	if len(keyFormat) < 12 {
+		return nil, fmt.Errorf("invalid key format")
+	}
+	tokenCount := int(le.Uint32(keyFormat[8:12]))
+	if len(keyFormat) < 12+tokenCount*4 {
+		return nil, fmt.Errorf("invalid key format")
+	}
+	keyAttributes := make(map[uint32]int)
+	for i := 0; i < tokenCount; i++ {
+		keyAttributes[le.Uint32(keyFormat[12+i*4:])] = i
+	}
+
+	// Facet keys map asset names to the identifier used in rendition keys
+	facetNames := make(map[uint16]string)
+	err = store.walkTree("FACETKEYS", func(key, value []byte) error {
+		if len(value) < 6 {
+			return nil
+		}
+		attributeCount := int(le.Uint16(value[4:6]))
+		for i := 0; i < attributeCount && 6+i*4+4 <= len(value); i++ {
+			attribute := value[6+i*4:]
+			if le.Uint16(attribute[0:2]) == carAttributeIdentifier {
+				facetNames[le.Uint16(attribute[2:4])] = string(key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read facet keys: %v", err)
+	}
+
+	keyValue := func(key []byte, attribute uint32) (uint16, bool) {
+		i, ok := keyAttributes[attribute]
+		if !ok || len(key) < (i+1)*2 {
+			return 0, false
+		}
+		return le.Uint16(key[i*2:]), true
 	}
 
 	// Group renditions by name
 	assetMap := make(map[string]*AssetInfo)
-	for _, catalog := range catalogs {
-		if catalog.SizeOnDisk == 0 {
-			continue
+	var assetNames []string
+	err = store.walkTree("RENDITIONS", func(key, value []byte) error {
+		if len(value) < csiHeaderSize || string(value[:4]) != "ISTC" {
+			return nil
 		}
 
+		identifier, _ := keyValue(key, carAttributeIdentifier)
+		name := facetNames[identifier]
+
 		// Skip renditions with empty names or system-generated packed assets
-		if catalog.Name == "" || strings.HasPrefix(catalog.Name, "ZZZZPackedAsset-") {
-			continue
+		if name == "" || strings.HasPrefix(name, "ZZZZPackedAsset-") {
+			return nil
 		}
 
-		// Get or create the AssetInfo for this name
-		name := catalog.Name
-		if name == "" {
-			name = catalog.SHA1Digest
+		renditionName := cString(value[40:168])
+		if renditionName == "" || strings.HasPrefix(renditionName, "ZZZZPackedAsset-") {
+			return nil
 		}
-		asset, exists := assetMap[name]
-		if !exists {
-			asset = &AssetInfo{
-				Name:          catalog.Name,
-				RenditionInfo: make([]RenditionInfo, 0),
-			}
-			assetMap[catalog.Name] = asset
+
+		idiomValue, _ := keyValue(key, carAttributeIdiom)
+		idiom, ok := carIdioms[idiomValue]
+		if !ok {
+			idiom = fmt.Sprintf("unknown(%d)", idiomValue)
 		}
 
-		// Skip renditions with empty names or system-generated packed assets
-		if catalog.RenditionName == "" || strings.HasPrefix(catalog.RenditionName, "ZZZZPackedAsset-") {
-			continue
+		scaleValue, _ := keyValue(key, carAttributeScale)
+		scale := int64(scaleValue)
+		if scale == 0 {
+			scale = int64(le.Uint32(value[20:24]) / 100)
+		}
+
+		tlvLength := uint64(le.Uint32(value[168:172]))
+		renditionLength := uint64(le.Uint32(value[180:184]))
+		payloadStart := uint64(csiHeaderSize) + tlvLength
+		payloadEnd := payloadStart + renditionLength
+		if payloadEnd > uint64(len(value)) {
+			payloadEnd = uint64(len(value))
 		}
+		if payloadStart > payloadEnd {
+			payloadStart = payloadEnd
+		}
+		payload := value[payloadStart:payloadEnd]
 
-		// Add the rendition info
-		renditionName := catalog.RenditionName
-		if renditionName == "" {
-			renditionName = catalog.SHA1Digest
+		// Renditions packed into an atlas carry no payload of their own,
+		// digest the whole rendition so they don't all look identical
+		digest := sha1.Sum(payload)
+		if len(payload) == 0 {
+			digest = sha1.Sum(value)
 		}
 		rendition := RenditionInfo{
 			RenditionName: renditionName,
-			Size:          catalog.SizeOnDisk,
-			Idiom:         catalog.Idiom,
-			Scale:         catalog.Scale,
-			Compression:   catalog.Compression,
-			Shasum:        catalog.SHA1Digest,
+			Size:          int64(len(value)),
+			Idiom:         idiom,
+			Scale:         scale,
+			Compression:   renditionCompression(le.Uint32(value[24:28]), payload),
+			Shasum:        strings.ToUpper(hex.EncodeToString(digest[:])),
+		}
+
+		// Get or create the AssetInfo for this name
+		asset, exists := assetMap[name]
+		if !exists {
+			asset = &AssetInfo{
+				Name:          name,
+				RenditionInfo: make([]RenditionInfo, 0),
+			}
+			assetMap[name] = asset
+			assetNames = append(assetNames, name)
 		}
 		asset.RenditionInfo = append(asset.RenditionInfo, rendition)
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read renditions: %v", err)
 	}
 
 	// Convert map to slice
 	assets := make([]AssetInfo, 0, len(assetMap))
-	for _, asset := range assetMap {
-		assets = append(assets, *asset)
-	}
-
-	relativePath, err := filepath.Rel(basePath, path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get relative path: %v", err)
+	for _, name := range assetNames {
+		assets = append(assets, *assetMap[name])
 	}
 
 	return &CarFileInfo{
-		Path:   relativePath,
+		Path:   name,
 		Assets: assets,
 	}, nil
 }
 
+// renditionCompression determines the compression of a rendition from its pixel format and payload
+func renditionCompression(pixelFormat uint32, payload []byte) string {
+	switch string(binary.BigEndian.AppendUint32(nil, pixelFormat)) {
+	case "JPEG":
+		return "jpeg"
+	case "HEIF":
+		return "heif"
+	}
+
+	// Bitmaps are stored as one or more CELM chunks carrying the compression type
+	if len(payload) >= 12 {
+		tag := string(payload[:4])
+		if tag == "KCBC" && len(payload) >= 28 {
+			payload = payload[16:]
+			tag = string(payload[:4])
+		}
+		if tag == "MLEC" {
+			compression := binary.LittleEndian.Uint32(payload[8:12])
+			if name, ok := carCompressions[compression]; ok {
+				return name
+			}
+			return fmt.Sprintf("unknown(%d)", compression)
+		}
+	}
+
+	return "uncompressed"
+}
+
+// cString returns the null-terminated string stored in the byte slice
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
 // FindAndAnalyzeCarFiles searches for and analyzes all .car files in the bundle
-func FindAndAnalyzeCarFiles(bundlePath string, bundle *AppBundle) error {
-	err := filepath.Walk(bundlePath, func(path string, info os.FileInfo, err error) error {
+func FindAndAnalyzeCarFiles(fsys fs.FS, bundle *AppBundle) error {
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
-		if !info.IsDir() && filepath.Ext(path) == ".car" {
-			carInfo, err := ParseCARFile(path, bundlePath)
+		if !entry.IsDir() && path.Ext(name) == ".car" {
+			carInfo, err := ParseCARFile(fsys, name)
 			if err != nil {
-				return fmt.Errorf("failed to analyze %s: %v", path, err)
+				return fmt.Errorf("failed to analyze %s: %v", name, err)
 			}
 			bundle.CarFiles = append(bundle.CarFiles, *carInfo)
 		}
@@ -0,0 +1,249 @@
+package analyzer
+
+import (
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// testBOMStore assembles a BOM store, block 0 is the null block
+type testBOMStore struct {
+	blocks [][]byte
+	names  []string
+	vars   []uint32
+}
+
+func (s *testBOMStore) block(data []byte) uint32 {
+	if len(s.blocks) == 0 {
+		s.blocks = append(s.blocks, nil)
+	}
+	s.blocks = append(s.blocks, data)
+	return uint32(len(s.blocks) - 1)
+}
+
+func (s *testBOMStore) named(name string, data []byte) {
+	s.names = append(s.names, name)
+	s.vars = append(s.vars, s.block(data))
+}
+
+// tree adds a tree with a single leaf holding the key and value pairs
+func (s *testBOMStore) tree(name string, entries [][2][]byte) {
+	leaf := binary.BigEndian.AppendUint16(nil, 1)
+	leaf = binary.BigEndian.AppendUint16(leaf, uint16(len(entries)))
+	leaf = append(leaf, make([]byte, 8)...)
+	for _, entry := range entries {
+		key := s.block(entry[0])
+		value := s.block(entry[1])
+		leaf = binary.BigEndian.AppendUint32(leaf, value)
+		leaf = binary.BigEndian.AppendUint32(leaf, key)
+	}
+
+	tree := append([]byte("tree"), 0, 0, 0, 1)
+	tree = binary.BigEndian.AppendUint32(tree, s.block(leaf))
+	tree = append(tree, make([]byte, 9)...)
+	s.named(name, tree)
+}
+
+// bytes lays out the header, the blocks, then the block and variable tables,
+// so cutting the store short always cuts the tables
+func (s *testBOMStore) bytes() []byte {
+	be := binary.BigEndian
+	data := make([]byte, 32)
+	addresses := make([]uint32, len(s.blocks))
+	for i, block := range s.blocks {
+		addresses[i] = uint32(len(data))
+		data = append(data, block...)
+	}
+
+	indexOffset := len(data)
+	data = be.AppendUint32(data, uint32(len(s.blocks)))
+	for i, block := range s.blocks {
+		data = be.AppendUint32(data, addresses[i])
+		data = be.AppendUint32(data, uint32(len(block)))
+	}
+
+	varsOffset := len(data)
+	data = be.AppendUint32(data, uint32(len(s.vars)))
+	for i, index := range s.vars {
+		data = be.AppendUint32(data, index)
+		data = append(data, byte(len(s.names[i])))
+		data = append(data, s.names[i]...)
+	}
+
+	copy(data, "BOMStore")
+	be.PutUint32(data[8:], 1)
+	be.PutUint32(data[12:], uint32(len(s.blocks)))
+	be.PutUint32(data[16:], uint32(indexOffset))
+	be.PutUint32(data[20:], uint32(varsOffset-indexOffset))
+	be.PutUint32(data[24:], uint32(varsOffset))
+	be.PutUint32(data[28:], uint32(len(data)-varsOffset))
+	return data
+}
+
+// testRendition is the CSI header of a rendition followed by its payload
+func testRendition(name string, pixelFormat string, payload []byte) []byte {
+	le := binary.LittleEndian
+	value := make([]byte, csiHeaderSize)
+	copy(value, "ISTC")
+	le.PutUint32(value[20:], 200)
+	copy(value[24:28], []byte{pixelFormat[3], pixelFormat[2], pixelFormat[1], pixelFormat[0]})
+	copy(value[40:168], name)
+	le.PutUint32(value[180:], uint32(len(payload)))
+	return append(value, payload...)
+}
+
+// testRenditionKey is a key of the identifier, idiom and scale attributes of testKeyFormat
+func testRenditionKey(identifier, idiom, scale uint16) []byte {
+	key := binary.LittleEndian.AppendUint16(nil, identifier)
+	key = binary.LittleEndian.AppendUint16(key, idiom)
+	return binary.LittleEndian.AppendUint16(key, scale)
+}
+
+func testKeyFormat() []byte {
+	le := binary.LittleEndian
+	keyFormat := append([]byte("tmfk"), make([]byte, 4)...)
+	keyFormat = le.AppendUint32(keyFormat, 3)
+	for _, attribute := range []uint32{carAttributeIdentifier, carAttributeIdiom, carAttributeScale} {
+		keyFormat = le.AppendUint32(keyFormat, attribute)
+	}
+	return keyFormat
+}
+
+func testFacet(identifier uint16) []byte {
+	le := binary.LittleEndian
+	facet := le.AppendUint32(nil, 0)
+	facet = le.AppendUint16(facet, 1)
+	facet = le.AppendUint16(facet, carAttributeIdentifier)
+	return le.AppendUint16(facet, identifier)
+}
+
+func testCELM(compression uint32) []byte {
+	celm := append([]byte("MLEC"), make([]byte, 4)...)
+	celm = binary.LittleEndian.AppendUint32(celm, compression)
+	return append(celm, 0xde, 0xad, 0xbe, 0xef)
+}
+
+func testAssetCatalog() []byte {
+	store := &testBOMStore{}
+	store.named("KEYFORMAT", testKeyFormat())
+	store.tree("FACETKEYS", [][2][]byte{
+		{[]byte("AppIcon"), testFacet(1)},
+		{[]byte("Logo"), testFacet(2)},
+		{[]byte("ZZZZPackedAsset-1.0.0-gamut0"), testFacet(3)},
+	})
+	store.tree("RENDITIONS", [][2][]byte{
+		{testRenditionKey(1, 1, 2), testRendition("AppIcon@2x.png", "ARGB", testCELM(4))},
+		{testRenditionKey(1, 2, 3), testRendition("AppIcon@3x.png", "ARGB", testCELM(11))},
+		{testRenditionKey(2, 0, 0), testRendition("Logo.jpg", "JPEG", []byte{0xff, 0xd8})},
+		{testRenditionKey(3, 0, 1), testRendition("ZZZZPackedAsset-1.0.0-gamut0", "ARGB", nil)},
+	})
+	return store.bytes()
+}
+
+func TestParseCARFile(t *testing.T) {
+	fsys := fstest.MapFS{"Assets.car": {Data: testAssetCatalog()}}
+
+	info, err := ParseCARFile(fsys, "Assets.car")
+	if err != nil {
+		t.Fatalf("ParseCARFile() error = %v", err)
+	}
+
+	type rendition struct {
+		asset, name, idiom, compression string
+		scale                           int64
+	}
+	var got []rendition
+	for _, asset := range info.Assets {
+		for _, r := range asset.RenditionInfo {
+			got = append(got, rendition{asset.Name, r.RenditionName, r.Idiom, r.Compression, r.Scale})
+			if r.Size <= csiHeaderSize || len(r.Shasum) != 40 {
+				t.Errorf("rendition %s has size %d and shasum %q", r.RenditionName, r.Size, r.Shasum)
+			}
+		}
+	}
+	want := []rendition{
+		{"AppIcon", "AppIcon@2x.png", "phone", "lzfse", 2},
+		{"AppIcon", "AppIcon@3x.png", "pad", "deepmap2", 3},
+		// The scale falls back to the one of the CSI header when the key has none
+		{"Logo", "Logo.jpg", "universal", "jpeg", 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseCARFile() renditions = %v, want %v", got, want)
+	}
+}
+
+func TestParseCARFileMalformed(t *testing.T) {
+	be := binary.BigEndian
+	catalog := testAssetCatalog()
+	indexOffset := be.Uint32(catalog[16:])
+	varsOffset := be.Uint32(catalog[24:])
+
+	withoutKeyFormat := &testBOMStore{}
+	withoutKeyFormat.tree("FACETKEYS", nil)
+	withoutKeyFormat.tree("RENDITIONS", nil)
+
+	notATree := &testBOMStore{}
+	notATree.named("KEYFORMAT", testKeyFormat())
+	notATree.named("FACETKEYS", []byte("leaf"))
+
+	hugeBlockCount := append([]byte{}, catalog...)
+	be.PutUint32(hugeBlockCount[indexOffset:], 0xffffffff)
+
+	// The length of block 1, the key format, runs past the end of the store
+	blockPastEnd := append([]byte{}, catalog...)
+	be.PutUint32(blockPastEnd[indexOffset+4+8+4:], 0xffff)
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{name: "wrong magic", data: append([]byte("BOMStorf"), catalog[8:]...), want: "not a BOM store"},
+		{name: "header only", data: catalog[:32], want: "block table out of bounds"},
+		{name: "block count past the end", data: hugeBlockCount, want: "block table out of bounds"},
+		{name: "block table cut short", data: catalog[:indexOffset+4+8], want: "block table out of bounds"},
+		{name: "variable count only", data: catalog[:varsOffset+4], want: "variable table out of bounds"},
+		{name: "variable name cut short", data: catalog[:varsOffset+4+5+2], want: "variable table out of bounds"},
+		{name: "block past the end", data: blockPastEnd, want: "block 1 out of bounds"},
+		{name: "missing key format", data: withoutKeyFormat.bytes(), want: "KEYFORMAT not found"},
+		{name: "facet keys not a tree", data: notATree.bytes(), want: "FACETKEYS is not a tree"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{"Assets.car": {Data: tt.data}}
+			_, err := ParseCARFile(fsys, "Assets.car")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseCARFile() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenditionCompression(t *testing.T) {
+	kcbc := append([]byte("KCBC"), make([]byte, 12)...)
+	tests := []struct {
+		name        string
+		pixelFormat string
+		payload     []byte
+		want        string
+	}{
+		{name: "jpeg", pixelFormat: "JPEG", want: "jpeg"},
+		{name: "heif", pixelFormat: "HEIF", want: "heif"},
+		{name: "lzfse bitmap", pixelFormat: "ARGB", payload: testCELM(4), want: "lzfse"},
+		{name: "palette image", pixelFormat: "ARGB", payload: testCELM(8), want: "palette-img"},
+		{name: "chunked bitmap", pixelFormat: "ARGB", payload: append(kcbc, testCELM(3)...), want: "lzvn"},
+		{name: "unknown compression", pixelFormat: "ARGB", payload: testCELM(99), want: "unknown(99)"},
+		{name: "no payload", pixelFormat: "ARGB", want: "uncompressed"},
+		{name: "truncated chunk", pixelFormat: "ARGB", payload: []byte("MLEC"), want: "uncompressed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pixelFormat := binary.BigEndian.Uint32([]byte(tt.pixelFormat))
+			if got := renditionCompression(pixelFormat, tt.payload); got != tt.want {
+				t.Errorf("renditionCompression() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+)
+
+// ChildBundle is a target embedded in the app, like an app extension, App Clip or watch app
+type ChildBundle struct {
+	Path             string        `json:"path"`
+	Kind             string        `json:"kind"`
+	BundleID         string        `json:"bundle_id"`
+	Version          string        `json:"version"`
+	MinimumOSVersion string        `json:"minimum_os_version"`
+	ExtensionPoint   string        `json:"extension_point,omitempty"`
+	Size             int64         `json:"size"`
+	CompressedSize   int64         `json:"compressed_size,omitempty"`
+	ChildBundles     []ChildBundle `json:"child_bundles,omitempty"`
+}
+
+// childBundleDirs maps the directories holding embedded targets to their kind and bundle extension
+var childBundleDirs = []struct {
+	dir       string
+	extension string
+	kind      string
+}{
+	{dir: "PlugIns", extension: ".appex", kind: "app_extension"},
+	{dir: "Extensions", extension: ".appex", kind: "app_extension"},
+	{dir: "AppClips", extension: ".app", kind: "app_clip"},
+	{dir: "Watch", extension: ".app", kind: "watch_app"},
+}
+
+// findChildBundles reads the embedded targets of the bundle at dir, recursively,
+// and marks their nodes in the file tree with their kind
+func findChildBundles(fsys fs.FS, dir string, files *FileInfo) ([]ChildBundle, error) {
+	var children []ChildBundle
+
+	for _, childDir := range childBundleDirs {
+		entries, err := fs.ReadDir(fsys, path.Join(dir, childDir.dir))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", childDir.dir, err)
+		}
+
+		for _, entry := range entries {
+			if !entry.IsDir() || path.Ext(entry.Name()) != childDir.extension {
+				continue
+			}
+
+			childPath := path.Join(dir, childDir.dir, entry.Name())
+			child, err := analyzeChildBundle(fsys, childPath, childDir.kind)
+			if err != nil {
+				fmt.Printf("Warning: failed to analyze %s: %v\n", childPath, err)
+				continue
+			}
+
+			if node := findFileInfo(files, childPath); node != nil {
+				child.Size = node.Size
+				child.CompressedSize = node.CompressedSize
+				node.Type = childDir.kind
+			}
+
+			child.ChildBundles, err = findChildBundles(fsys, childPath, files)
+			if err != nil {
+				return nil, err
+			}
+
+			children = append(children, child)
+		}
+	}
+
+	return children, nil
+}
+
+// analyzeChildBundle reads the identity of an embedded target from its Info.plist
+func analyzeChildBundle(fsys fs.FS, childPath string, kind string) (ChildBundle, error) {
+	child := ChildBundle{
+		Path: childPath,
+		Kind: kind,
+	}
+
+	data, err := readInfoPlist(fsys, path.Join(childPath, "Info.plist"))
+	if err != nil {
+		return child, err
+	}
+
+	child.BundleID, _ = data["CFBundleIdentifier"].(string)
+	child.Version, _ = data["CFBundleShortVersionString"].(string)
+	child.MinimumOSVersion, _ = data["MinimumOSVersion"].(string)
+	if child.MinimumOSVersion == "" {
+		child.MinimumOSVersion, _ = data["LSMinimumSystemVersion"].(string)
+	}
+
+	if extension, ok := data["NSExtension"].(map[string]interface{}); ok {
+		child.ExtensionPoint, _ = extension["NSExtensionPointIdentifier"].(string)
+	} else if extensionKit, ok := data["EXAppExtensionAttributes"].(map[string]interface{}); ok {
+		child.ExtensionPoint, _ = extensionKit["EXExtensionPointIdentifier"].(string)
+	}
+
+	return child, nil
+}
@@ -0,0 +1,372 @@
+package analyzer
+
+import (
+	"strings"
+
+	"github.com/ianlancetaylor/demangle"
+)
+
+// symbolName is the qualified name recovered from a symbol, only C++ names keep the signature of functions
+type symbolName struct {
+	// Language is "swift", "c++", "objc" or "c"
+	Language string
+	// Module is the Swift module, or the outermost C++ namespace
+	Module string
+	// Type is the qualified name of the type the symbol belongs to
+	Type string
+	// ObjCClass is the Objective-C class the symbol belongs to
+	ObjCClass string
+	// Name is the readable name of the symbol
+	Name string
+}
+
+// demangleSymbol recovers the qualified name of a Swift, C++ or Objective-C symbol,
+// names it doesn't understand are returned as they are
+func demangleSymbol(mangled string) symbolName {
+	// Mach-O prefixes C names with an underscore
+	name := strings.TrimPrefix(mangled, "_")
+
+	if demangled, ok := demangleObjC(name); ok {
+		return demangled
+	}
+	if demangled, ok := demangleSwift(name); ok {
+		return demangled
+	}
+	if demangled, ok := demangleCpp(name); ok {
+		return demangled
+	}
+
+	return symbolName{Language: "c", Name: name}
+}
+
+// objcSymbolPrefixes are the prefixes of the metadata the compiler emits for an Objective-C class
+var objcSymbolPrefixes = []string{
+	"OBJC_CLASS_$_",
+	"OBJC_METACLASS_$_",
+	"OBJC_IVAR_$_",
+	"_OBJC_CLASS_RO_$_",
+	"_OBJC_METACLASS_RO_$_",
+	"_OBJC_$_INSTANCE_METHODS_",
+	"_OBJC_$_CLASS_METHODS_",
+	"_OBJC_$_INSTANCE_VARIABLES_",
+	"_OBJC_$_PROP_LIST_",
+	"_OBJC_$_CLASS_PROP_LIST_",
+	"_OBJC_$_PROTOCOL_REFS_",
+	"_OBJC_$_CATEGORY_INSTANCE_METHODS_",
+	"_OBJC_$_CATEGORY_CLASS_METHODS_",
+	"_OBJC_$_CATEGORY_",
+}
+
+// demangleObjC reads the class of Objective-C methods, like "-[Class(Category) selector:]", and class metadata
+func demangleObjC(name string) (symbolName, bool) {
+	if (strings.HasPrefix(name, "-[") || strings.HasPrefix(name, "+[")) && strings.HasSuffix(name, "]") {
+		class, _, _ := strings.Cut(name[2:], " ")
+		class, _, _ = strings.Cut(class, "(")
+		return symbolName{Language: "objc", ObjCClass: class, Name: name}, true
+	}
+
+	for _, prefix := range objcSymbolPrefixes {
+		if rest, ok := strings.CutPrefix(name, prefix); ok {
+			// Instance variables are named Class.ivar and categories Class_$_Category
+			class, _, _ := strings.Cut(rest, ".")
+			class, _, _ = strings.Cut(class, "_$_")
+			return symbolName{Language: "objc", ObjCClass: class, Name: name}, true
+		}
+	}
+
+	return symbolName{}, false
+}
+
+// swiftStandardTypes are the standard library types with a single letter substitution after "S"
+var swiftStandardTypes = map[byte]string{
+	'a': "Array", 'b': "Bool", 'D': "Dictionary", 'd': "Double", 'f': "Float", 'h': "Set",
+	'I': "DefaultIndices", 'i': "Int", 'J': "Character", 'N': "ClosedRange", 'n': "Range",
+	'O': "ObjectIdentifier", 'P': "UnsafePointer", 'p': "UnsafeMutablePointer",
+	'Q': "ImplicitlyUnwrappedOptional", 'q': "Optional", 'R': "UnsafeBufferPointer",
+	'r': "UnsafeMutableBufferPointer", 'S': "String", 's': "Substring", 'u': "UInt",
+	'V': "UnsafeRawPointer", 'v': "UnsafeMutableRawPointer", 'W': "UnsafeRawBufferPointer",
+	'w': "UnsafeMutableRawBufferPointer",
+}
+
+// swiftNominalKinds are the operators closing the context of a nominal type
+var swiftNominalKinds = "CVOPa"
+
+// swiftDemangler reads the leading context of a Swift mangled name, see docs/ABI/Mangling.rst of the Swift repository
+type swiftDemangler struct {
+	text  string
+	pos   int
+	words []string
+}
+
+// demangleSwift recovers the module, the enclosing types and the name of a Swift symbol,
+// like "$s8HexaCalc14ViewControllerC11viewDidLoadyyF" to HexaCalc.ViewController.viewDidLoad
+func demangleSwift(name string) (symbolName, bool) {
+	var text string
+	for _, prefix := range []string{"$s", "$S", "$e", "_T0"} {
+		if rest, ok := strings.CutPrefix(name, prefix); ok {
+			text = rest
+			break
+		}
+	}
+	if text == "" {
+		return symbolName{}, false
+	}
+
+	d := &swiftDemangler{text: text}
+	module, standardType, ok := d.module()
+	if !ok {
+		return symbolName{}, false
+	}
+
+	var path []string
+	if standardType != "" {
+		path = append(path, standardType)
+	}
+	var member string
+	for d.pos < len(d.text) {
+		identifier, ok := d.identifier()
+		if !ok {
+			break
+		}
+		if d.pos < len(d.text) && strings.IndexByte(swiftNominalKinds, d.text[d.pos]) >= 0 {
+			d.pos++
+			path = append(path, identifier)
+			continue
+		}
+		// Extensions are attributed to the module that declares them
+		if d.pos < len(d.text) && d.text[d.pos] == 'E' {
+			d.pos++
+			module = identifier
+			continue
+		}
+		member = identifier
+		break
+	}
+
+	demangled := symbolName{Language: "swift", Module: module, Name: name}
+	if len(path) > 0 {
+		demangled.Type = module + "." + strings.Join(path, ".")
+	}
+	if len(path) > 0 || member != "" {
+		demangled.Name = strings.Join(append(append([]string{module}, path...), member), ".")
+		demangled.Name = strings.TrimSuffix(demangled.Name, ".")
+	}
+	return demangled, true
+}
+
+// module reads the module the entity is declared in, the standard library and imported C modules
+// are abbreviated, as are the common standard library types which are returned as well
+func (d *swiftDemangler) module() (string, string, bool) {
+	if d.pos >= len(d.text) {
+		return "", "", false
+	}
+
+	switch d.text[d.pos] {
+	case 's':
+		d.pos++
+		return "Swift", "", true
+	case 'S':
+		if d.pos+1 >= len(d.text) {
+			return "", "", false
+		}
+		next := d.text[d.pos+1]
+		d.pos += 2
+		switch {
+		case next == 'o':
+			return "__C", "", true
+		case next == 'C':
+			return "__C_Synthesized", "", true
+		case swiftStandardTypes[next] != "":
+			return "Swift", swiftStandardTypes[next], true
+		}
+		return "", "", false
+	}
+
+	module, ok := d.identifier()
+	return module, "", ok
+}
+
+// identifier reads a length-prefixed identifier, which may reuse words of the identifiers before it
+func (d *swiftDemangler) identifier() (string, bool) {
+	if d.pos >= len(d.text) || !isDigit(d.text[d.pos]) {
+		return "", false
+	}
+
+	hasWordSubstitutions := false
+	if d.text[d.pos] == '0' {
+		d.pos++
+		if d.pos < len(d.text) && d.text[d.pos] == '0' {
+			// Punycode encoded identifiers are not decoded
+			return "", false
+		}
+		hasWordSubstitutions = true
+	}
+
+	var identifier strings.Builder
+	for {
+		for hasWordSubstitutions && d.pos < len(d.text) && isLetter(d.text[d.pos]) {
+			c := d.text[d.pos]
+			d.pos++
+			index := int(c - 'a')
+			if c >= 'A' && c <= 'Z' {
+				index = int(c - 'A')
+				hasWordSubstitutions = false
+			}
+			if index >= len(d.words) {
+				return "", false
+			}
+			identifier.WriteString(d.words[index])
+		}
+
+		if d.pos < len(d.text) && d.text[d.pos] == '0' {
+			d.pos++
+			break
+		}
+		if !hasWordSubstitutions && identifier.Len() > 0 && (d.pos >= len(d.text) || !isDigit(d.text[d.pos])) {
+			break
+		}
+
+		length, ok := d.natural()
+		if !ok || length <= 0 || length > len(d.text)-d.pos {
+			return "", false
+		}
+		slice := d.text[d.pos : d.pos+length]
+		d.pos += length
+		identifier.WriteString(slice)
+		d.addWords(slice)
+
+		if !hasWordSubstitutions {
+			break
+		}
+	}
+
+	return identifier.String(), identifier.Len() > 0
+}
+
+// addWords records the words of an identifier, so later identifiers can refer to them
+func (d *swiftDemangler) addWords(slice string) {
+	const maxWords = 26
+
+	wordStart := -1
+	for i := 0; i <= len(slice); i++ {
+		var c byte
+		if i < len(slice) {
+			c = slice[i]
+		}
+		if wordStart >= 0 && (c == '_' || c == 0 || (isUpperLetter(c) && !isUpperLetter(slice[i-1]))) {
+			if i-wordStart >= 2 && len(d.words) < maxWords {
+				d.words = append(d.words, slice[wordStart:i])
+			}
+			wordStart = -1
+		}
+		if wordStart < 0 && c != 0 && c != '_' && !isDigit(c) {
+			wordStart = i
+		}
+	}
+}
+
+// natural reads a decimal number
+func (d *swiftDemangler) natural() (int, bool) {
+	start := d.pos
+	n := 0
+	for d.pos < len(d.text) && isDigit(d.text[d.pos]) {
+		n = n*10 + int(d.text[d.pos]-'0')
+		d.pos++
+	}
+	return n, d.pos > start
+}
+
+// demangleCpp demangles a C++ symbol, like "_ZN3foo3BarIiE3bazEv" to foo::Bar<int>::baz(), the type
+// is the scope the symbol is defined in, or the class itself for its vtable and type info
+func demangleCpp(name string) (symbolName, bool) {
+	// Blocks of C++ functions keep one more underscore
+	if strings.HasPrefix(name, "__Z") {
+		name = name[1:]
+	}
+	if !strings.HasPrefix(name, "_Z") && !strings.HasPrefix(name, "___Z") {
+		return symbolName{}, false
+	}
+
+	ast, err := demangle.ToAST(name)
+	if err != nil {
+		return symbolName{}, false
+	}
+	components := cppNameComponents(ast)
+	if len(components) == 0 {
+		return symbolName{}, false
+	}
+
+	demangled := symbolName{
+		Language: "c++",
+		Name:     demangle.ASTToString(ast),
+	}
+	if len(components) > 1 {
+		demangled.Module = components[0]
+		demangled.Type = strings.Join(components[:len(components)-1], "::")
+	}
+	// Class data belongs to the class itself
+	if isCppClassData(ast) {
+		demangled.Module = components[0]
+		demangled.Type = strings.Join(components, "::")
+	}
+	return demangled, true
+}
+
+// cppNameComponents returns the components of the qualified name of the entity, with their template arguments,
+// local entities are attributed to the function enclosing them
+func cppNameComponents(node demangle.AST) []string {
+	switch n := node.(type) {
+	case *demangle.Typed:
+		return cppNameComponents(n.Name)
+	case *demangle.Clone:
+		return cppNameComponents(n.Base)
+	case *demangle.Special:
+		return cppNameComponents(n.Val)
+	case *demangle.Special2:
+		return cppNameComponents(n.Val1)
+	case *demangle.Qualified:
+		if n.LocalName {
+			return cppNameComponents(n.Scope)
+		}
+		return append(cppNameComponents(n.Scope), demangle.ASTToString(n.Name))
+	case *demangle.Template:
+		components := cppNameComponents(n.Name)
+		if len(components) == 0 {
+			return nil
+		}
+		scope := strings.Join(components[:len(components)-1], "::")
+		components[len(components)-1] = demangle.ASTToString(n)
+		if scope != "" {
+			components[len(components)-1] = strings.TrimPrefix(components[len(components)-1], scope+"::")
+		}
+		return components
+	}
+	return []string{demangle.ASTToString(node)}
+}
+
+// isCppClassData reports whether the symbol is the vtable, VTT or type info the compiler emits for a class
+func isCppClassData(node demangle.AST) bool {
+	switch n := node.(type) {
+	case *demangle.Special:
+		return strings.HasPrefix(n.Prefix, "vtable") || strings.HasPrefix(n.Prefix, "VTT") || strings.HasPrefix(n.Prefix, "typeinfo")
+	case *demangle.Special2:
+		return true
+	}
+	return false
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLowerLetter(c byte) bool {
+	return c >= 'a' && c <= 'z'
+}
+
+func isUpperLetter(c byte) bool {
+	return c >= 'A' && c <= 'Z'
+}
+
+func isLetter(c byte) bool {
+	return isLowerLetter(c) || isUpperLetter(c)
+}
@@ -0,0 +1,150 @@
+package analyzer
+
+import (
+	"testing"
+)
+
+func TestDemangleSymbol(t *testing.T) {
+	tests := []struct {
+		mangled string
+		want    symbolName
+	}{
+		// Swift
+		{
+			mangled: "_$s8HexaCalc14ViewControllerC11viewDidLoadyyF",
+			want:    symbolName{Language: "swift", Module: "HexaCalc", Type: "HexaCalc.ViewController", Name: "HexaCalc.ViewController.viewDidLoad"},
+		},
+		{
+			mangled: "_$s8HexaCalc14ViewControllerC09calculateD0yyF",
+			want:    symbolName{Language: "swift", Module: "HexaCalc", Type: "HexaCalc.ViewController", Name: "HexaCalc.ViewController.calculateController"},
+		},
+		{
+			mangled: "_$s8HexaCalc5ModelV5StateO4nextAFyF",
+			want:    symbolName{Language: "swift", Module: "HexaCalc", Type: "HexaCalc.Model.State", Name: "HexaCalc.Model.State.next"},
+		},
+		{
+			mangled: "_$sSS8HexaCalcE8isNumberSbvg",
+			want:    symbolName{Language: "swift", Module: "HexaCalc", Type: "HexaCalc.String", Name: "HexaCalc.String.isNumber"},
+		},
+		{
+			mangled: "_$sSo8NSObjectCMa",
+			want:    symbolName{Language: "swift", Module: "__C", Type: "__C.NSObject", Name: "__C.NSObject"},
+		},
+		{
+			mangled: "_$ss5printyyypd_SS9separatorSS10terminatortF",
+			want:    symbolName{Language: "swift", Module: "Swift", Name: "Swift.print"},
+		},
+		{
+			mangled: "__T08HexaCalc4MainC3runyyF",
+			want:    symbolName{Language: "swift", Module: "HexaCalc", Type: "HexaCalc.Main", Name: "HexaCalc.Main.run"},
+		},
+		// C++
+		{
+			mangled: "__ZN3foo3Bar3bazEv",
+			want:    symbolName{Language: "c++", Module: "foo", Type: "foo::Bar", Name: "foo::Bar::baz()"},
+		},
+		{
+			mangled: "__ZNSt6vectorIiSaIiEE9push_backERKi",
+			want: symbolName{Language: "c++", Module: "std", Type: "std::vector<int, std::allocator<int> >",
+				Name: "std::vector<int, std::allocator<int> >::push_back(int const&)"},
+		},
+		{
+			mangled: "__ZTVN3foo3BarE",
+			want:    symbolName{Language: "c++", Module: "foo", Type: "foo::Bar", Name: "vtable for foo::Bar"},
+		},
+		{
+			mangled: "____ZN3foo3barEv_block_invoke",
+			want:    symbolName{Language: "c++", Module: "foo", Type: "foo", Name: "invocation function for block in foo::bar()"},
+		},
+		// Objective-C
+		{
+			mangled: "-[HCViewController(Keyboard) keyPressed:]",
+			want:    symbolName{Language: "objc", ObjCClass: "HCViewController", Name: "-[HCViewController(Keyboard) keyPressed:]"},
+		},
+		{
+			mangled: "_OBJC_CLASS_$_HCViewController",
+			want:    symbolName{Language: "objc", ObjCClass: "HCViewController", Name: "OBJC_CLASS_$_HCViewController"},
+		},
+		{
+			mangled: "_OBJC_IVAR_$_HCViewController._display",
+			want:    symbolName{Language: "objc", ObjCClass: "HCViewController", Name: "OBJC_IVAR_$_HCViewController._display"},
+		},
+		// C
+		{
+			mangled: "_main",
+			want:    symbolName{Language: "c", Name: "main"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mangled, func(t *testing.T) {
+			if got := demangleSymbol(tt.mangled); got != tt.want {
+				t.Errorf("demangleSymbol() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDemangleCpp(t *testing.T) {
+	tests := []struct {
+		mangled  string
+		wantName string
+		wantType string
+		wantOK   bool
+	}{
+		{mangled: "_Z3fooi", wantName: "foo(int)", wantOK: true},
+		{mangled: "_ZN3foo3BarIiE3bazEi", wantName: "foo::Bar<int>::baz(int)", wantType: "foo::Bar<int>", wantOK: true},
+		{mangled: "_ZN3foo3BarC2Ev", wantName: "foo::Bar::Bar()", wantType: "foo::Bar", wantOK: true},
+		{mangled: "_ZN3foo3BarD0Ev", wantName: "foo::Bar::~Bar()", wantType: "foo::Bar", wantOK: true},
+		{mangled: "_ZN3foo3BarplERKS0_", wantName: "foo::Bar::operator+(foo::Bar const&)", wantType: "foo::Bar", wantOK: true},
+		{mangled: "_ZN12_GLOBAL__N_16helperEv", wantName: "(anonymous namespace)::helper()", wantType: "(anonymous namespace)", wantOK: true},
+		{mangled: "_ZZN3foo3Bar3bazEvE5cache", wantName: "foo::Bar::baz()::cache", wantType: "foo::Bar", wantOK: true},
+		{mangled: "_ZThn8_N3foo3Bar3bazEv", wantName: "non-virtual thunk to foo::Bar::baz()", wantType: "foo::Bar", wantOK: true},
+		{mangled: "_ZTIN3foo3BarE", wantName: "typeinfo for foo::Bar", wantType: "foo::Bar", wantOK: true},
+		{mangled: "_ZGVZN3foo3barEvE1x", wantName: "guard variable for foo::bar()::x", wantType: "foo", wantOK: true},
+		{mangled: "_ZN3foo3barEv.cold", wantName: "foo::bar() [clone .cold]", wantType: "foo", wantOK: true},
+		// Malformed and truncated names
+		{mangled: "_Z"},
+		{mangled: "_ZN3foo"},
+		{mangled: "_ZN3foo3BarIiE3baz"},
+		{mangled: "_ZN99fooE"},
+		{mangled: "_ZNS_3fooE"},
+		{mangled: "_ZN3fooIIIIE3barEv"},
+		{mangled: "main"},
+		{mangled: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mangled, func(t *testing.T) {
+			got, ok := demangleCpp(tt.mangled)
+			if ok != tt.wantOK || got.Name != tt.wantName || got.Type != tt.wantType {
+				t.Errorf("demangleCpp() = %q, %q, %v, want %q, %q, %v", got.Name, got.Type, ok, tt.wantName, tt.wantType, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestDemangleSwiftMalformed(t *testing.T) {
+	tests := []string{
+		"$s",
+		"$s8Hexa",
+		"$sS",
+		"$sSZ",
+		"$s0a",
+		"$s00Hexa",
+		"$s9223372036854775807HexaCalc",
+		"$s99999999999999999999HexaCalc",
+	}
+	for _, mangled := range tests {
+		t.Run(mangled, func(t *testing.T) {
+			if got, ok := demangleSwift(mangled); ok {
+				t.Errorf("demangleSwift() = %+v, want no name", got)
+			}
+		})
+	}
+
+	// Names cut anywhere must not panic, the shorter ones may still demangle to their leading context
+	for _, mangled := range []string{"$s8HexaCalc14ViewControllerC09calculateD0yyF", "_ZNSt6vectorIiSaIiEE9push_backERKi"} {
+		for n := 0; n <= len(mangled); n++ {
+			demangleSymbol(mangled[:n])
+		}
+	}
+}
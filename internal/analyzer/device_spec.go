@@ -0,0 +1,375 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DeviceSpec describes a target device, using bundletool's device-spec JSON format
+type DeviceSpec struct {
+	Name             string   `json:"-"`
+	SupportedAbis    []string `json:"supportedAbis"`
+	SupportedLocales []string `json:"supportedLocales"`
+	ScreenDensity    int      `json:"screenDensity"`
+	SdkVersion       int      `json:"sdkVersion"`
+}
+
+// DeviceSizeEstimate is the estimated size of the split APKs delivered to a single device
+type DeviceSizeEstimate struct {
+	Name          string `json:"name"`
+	Abi           string `json:"abi,omitempty"`
+	ScreenDensity string `json:"screen_density"`
+	Language      string `json:"language"`
+	DownloadSize  int64  `json:"download_size"`
+	InstallSize   int64  `json:"install_size"`
+}
+
+// SizeEstimates holds per-device size estimates computed from an app bundle's split dimensions
+type SizeEstimates struct {
+	SplitDimensions []string             `json:"split_dimensions"`
+	MinDownloadSize int64                `json:"min_download_size"`
+	MaxDownloadSize int64                `json:"max_download_size"`
+	MinInstallSize  int64                `json:"min_install_size"`
+	MaxInstallSize  int64                `json:"max_install_size"`
+	Devices         []DeviceSizeEstimate `json:"devices"`
+}
+
+// Split dimensions of BundleConfig.pb
+const (
+	splitDimensionAbi           = 1
+	splitDimensionScreenDensity = 2
+	splitDimensionLanguage      = 3
+)
+
+var splitDimensionNames = map[int]string{
+	splitDimensionAbi:           "abi",
+	splitDimensionScreenDensity: "screen_density",
+	splitDimensionLanguage:      "language",
+}
+
+// typicalDeviceSpecs are the devices every app bundle is estimated for
+var typicalDeviceSpecs = []DeviceSpec{
+	{Name: "Phone", SupportedAbis: []string{"arm64-v8a", "armeabi-v7a", "armeabi"}, SupportedLocales: []string{"en-US"}, ScreenDensity: 480, SdkVersion: 33},
+	{Name: "High-end phone", SupportedAbis: []string{"arm64-v8a", "armeabi-v7a", "armeabi"}, SupportedLocales: []string{"en-US"}, ScreenDensity: 640, SdkVersion: 34},
+	{Name: "Budget phone", SupportedAbis: []string{"armeabi-v7a", "armeabi"}, SupportedLocales: []string{"en-US"}, ScreenDensity: 240, SdkVersion: 28},
+	{Name: "Tablet", SupportedAbis: []string{"arm64-v8a", "armeabi-v7a", "armeabi"}, SupportedLocales: []string{"en-US"}, ScreenDensity: 320, SdkVersion: 33},
+	{Name: "x86_64 device", SupportedAbis: []string{"x86_64", "x86"}, SupportedLocales: []string{"en-US"}, ScreenDensity: 320, SdkVersion: 33},
+}
+
+// splitEntry is a file of an install-time module along with the split it ends up in
+type splitEntry struct {
+	compressed   int64
+	uncompressed int64
+	abi          string
+	language     string
+	density      int
+	resourceKey  string
+}
+
+// LoadDeviceSpec reads a bundletool device-spec JSON file
+func LoadDeviceSpec(specPath string) (DeviceSpec, error) {
+	data, err := os.ReadFile(specPath)
+	if err != nil {
+		return DeviceSpec{}, fmt.Errorf("failed to read device spec: %v", err)
+	}
+
+	var spec DeviceSpec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return DeviceSpec{}, fmt.Errorf("failed to parse device spec %s: %v", specPath, err)
+	}
+	spec.Name = strings.TrimSuffix(filepath.Base(specPath), filepath.Ext(specPath))
+
+	return spec, nil
+}
+
+// parseSplitDimensions returns the split dimensions enabled by BundleConfig.pb
+func parseSplitDimensions(bundleConfig []byte) (map[int]bool, error) {
+	// bundletool splits by ABI, screen density and language unless told otherwise
+	dimensions := map[int]bool{
+		splitDimensionAbi:           true,
+		splitDimensionScreenDensity: true,
+		splitDimensionLanguage:      true,
+	}
+
+	config, err := parseProto(bundleConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse BundleConfig.pb: %v", err)
+	}
+
+	// optimizations.splits_config.split_dimension
+	splitsConfig := protoMessage(protoMessage(config, 2), 1)
+	for _, field := range splitsConfig {
+		if field.Number != 1 || field.WireType != protoBytes {
+			continue
+		}
+		dimension, err := parseProto(field.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse split dimension: %v", err)
+		}
+
+		var value int
+		negate := false
+		for _, f := range dimension {
+			switch f.Number {
+			case 1:
+				value = int(f.Varint)
+			case 2:
+				negate = f.Varint != 0
+			}
+		}
+		dimensions[value] = !negate
+	}
+
+	return dimensions, nil
+}
+
+// estimateDeviceSizes computes per-device download and install sizes of an app bundle,
+// tables are the resources.pb of its modules, their localized values go to the language splits
+func estimateDeviceSizes(archive *archiveFS, modules []BundleModule, tables []ResourceTable, specs []DeviceSpec) (*SizeEstimates, error) {
+	installTime := make(map[string]bool)
+	for _, module := range modules {
+		if module.Delivery == "install-time" {
+			installTime[module.Name] = true
+		}
+	}
+
+	// A bundle without BundleConfig.pb gets the default split dimensions
+	bundleConfig, err := fs.ReadFile(archive, "BundleConfig.pb")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read BundleConfig.pb: %v", err)
+	}
+	dimensions, err := parseSplitDimensions(bundleConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	localizedSizes := make(map[string]map[string]int64)
+	for _, table := range tables {
+		localizedSizes[table.Path] = localizedValueSizes(table)
+	}
+
+	var entries []splitEntry
+	for _, file := range archive.archive.reader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+
+		module, name, found := strings.Cut(file.Name, "/")
+		if !found || !installTime[module] {
+			continue
+		}
+
+		entry := splitEntry{
+			compressed:   int64(file.CompressedSize64),
+			uncompressed: int64(file.UncompressedSize64),
+		}
+
+		parts := strings.Split(name, "/")
+		if len(parts) >= 3 && parts[0] == "lib" {
+			entry.abi = parts[1]
+		}
+		if len(parts) >= 3 && parts[0] == "res" {
+			qualifiers := parseResourceQualifiers(parts[1])
+			entry.language, _, _ = strings.Cut(qualifiers.Locale, "-")
+			if dpi := densityDPI(qualifiers.Density); dpi > 0 {
+				entry.density = dpi
+				// Alternatives of the same resource only differ in their density
+				dir := strings.Replace(parts[1], "-"+qualifiers.Density, "", 1)
+				entry.resourceKey = path.Join(module, dir, parts[len(parts)-1])
+			}
+		}
+
+		// String values live in resources.pb rather than res/values-xx files, move the
+		// localized ones out of the table, compressed as well as the rest of it
+		for language, size := range localizedSizes[file.Name] {
+			if size > entry.uncompressed {
+				size = entry.uncompressed
+			}
+			var compressed int64
+			if entry.uncompressed > 0 {
+				compressed = size * entry.compressed / entry.uncompressed
+			}
+			entries = append(entries, splitEntry{compressed: compressed, uncompressed: size, language: language})
+			entry.compressed -= compressed
+			entry.uncompressed -= size
+		}
+
+		entries = append(entries, entry)
+	}
+
+	estimates := &SizeEstimates{
+		SplitDimensions: make([]string, 0),
+		Devices:         make([]DeviceSizeEstimate, 0),
+	}
+	for _, value := range []int{splitDimensionAbi, splitDimensionScreenDensity, splitDimensionLanguage} {
+		if dimensions[value] {
+			estimates.SplitDimensions = append(estimates.SplitDimensions, splitDimensionNames[value])
+		}
+	}
+
+	for _, spec := range specs {
+		estimate, ok := estimateDeviceSize(entries, dimensions, spec)
+		if !ok {
+			fmt.Printf("Warning: device spec %s doesn't support any ABI of the bundle\n", spec.Name)
+			continue
+		}
+		estimates.Devices = append(estimates.Devices, estimate)
+	}
+
+	// Enumerate every combination of split dimension values for the range
+	abis := []string{""}
+	languages := []string{""}
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.abi != "" && !seen["abi:"+entry.abi] {
+			seen["abi:"+entry.abi] = true
+			abis = append(abis, entry.abi)
+		}
+		if entry.language != "" && !seen["language:"+entry.language] {
+			seen["language:"+entry.language] = true
+			languages = append(languages, entry.language)
+		}
+	}
+	if len(abis) > 1 {
+		abis = abis[1:]
+	}
+
+	first := true
+	for _, abi := range abis {
+		for _, density := range densityBuckets {
+			for _, language := range languages {
+				spec := DeviceSpec{
+					SupportedAbis:    []string{abi},
+					SupportedLocales: []string{language},
+					ScreenDensity:    densityDPIs[density],
+				}
+				estimate, _ := estimateDeviceSize(entries, dimensions, spec)
+				if first || estimate.DownloadSize < estimates.MinDownloadSize {
+					estimates.MinDownloadSize = estimate.DownloadSize
+				}
+				if first || estimate.DownloadSize > estimates.MaxDownloadSize {
+					estimates.MaxDownloadSize = estimate.DownloadSize
+				}
+				if first || estimate.InstallSize < estimates.MinInstallSize {
+					estimates.MinInstallSize = estimate.InstallSize
+				}
+				if first || estimate.InstallSize > estimates.MaxInstallSize {
+					estimates.MaxInstallSize = estimate.InstallSize
+				}
+				first = false
+			}
+		}
+	}
+
+	return estimates, nil
+}
+
+// localizedValueSizes sums the size of the values of the resource table by the language of their configuration
+func localizedValueSizes(table ResourceTable) map[string]int64 {
+	sizes := make(map[string]int64)
+	for _, value := range table.values {
+		if language, _, _ := strings.Cut(value.config.locale, "-"); language != "" {
+			sizes[language] += value.size
+		}
+	}
+	return sizes
+}
+
+// estimateDeviceSize sums the entries bundletool would deliver to the given device
+func estimateDeviceSize(entries []splitEntry, dimensions map[int]bool, spec DeviceSpec) (DeviceSizeEstimate, bool) {
+	estimate := DeviceSizeEstimate{
+		Name:          spec.Name,
+		ScreenDensity: densityBucket(spec.ScreenDensity),
+	}
+
+	languages := make(map[string]bool)
+	for _, locale := range spec.SupportedLocales {
+		language, _, _ := strings.Cut(locale, "-")
+		languages[language] = true
+		if estimate.Language == "" {
+			estimate.Language = locale
+		}
+	}
+
+	// Pick the first ABI of the device that the bundle ships native code for
+	bundleAbis := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.abi != "" {
+			bundleAbis[entry.abi] = true
+		}
+	}
+	if dimensions[splitDimensionAbi] && len(bundleAbis) > 0 {
+		for _, abi := range spec.SupportedAbis {
+			if bundleAbis[abi] {
+				estimate.Abi = abi
+				break
+			}
+		}
+		if estimate.Abi == "" {
+			return estimate, false
+		}
+	}
+
+	// Pick the best density alternative of every resource: the closest higher
+	// density, or the highest one when the device is denser than all of them
+	bestDensity := make(map[string]int)
+	if dimensions[splitDimensionScreenDensity] {
+		for _, entry := range entries {
+			if entry.resourceKey == "" {
+				continue
+			}
+			current, ok := bestDensity[entry.resourceKey]
+			if !ok || isBetterDensity(entry.density, current, spec.ScreenDensity) {
+				bestDensity[entry.resourceKey] = entry.density
+			}
+		}
+	}
+
+	for _, entry := range entries {
+		if estimate.Abi != "" && entry.abi != "" && entry.abi != estimate.Abi {
+			continue
+		}
+		if dimensions[splitDimensionLanguage] && entry.language != "" && !languages[entry.language] {
+			continue
+		}
+		if best, ok := bestDensity[entry.resourceKey]; ok && entry.resourceKey != "" && entry.density != best {
+			continue
+		}
+
+		estimate.DownloadSize += entry.compressed
+		estimate.InstallSize += entry.uncompressed
+	}
+
+	return estimate, true
+}
+
+// isBetterDensity reports whether candidate suits the device density better than current
+func isBetterDensity(candidate, current, device int) bool {
+	if candidate >= device && current >= device {
+		return candidate < current
+	}
+	if candidate >= device || current >= device {
+		return candidate >= device
+	}
+	return candidate > current
+}
+
+// deviceSpecs returns the typical device specs followed by the custom ones
+func deviceSpecs(specPaths []string) ([]DeviceSpec, error) {
+	specs := append([]DeviceSpec{}, typicalDeviceSpecs...)
+	for _, specPath := range specPaths {
+		spec, err := LoadDeviceSpec(specPath)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+
+	return specs, nil
+}
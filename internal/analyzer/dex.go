@@ -1,218 +1,621 @@
 package analyzer
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
-	"os"
-	"os/exec"
-	"path/filepath"
+	"io/fs"
+	"path"
+	"sort"
 	"strings"
 )
 
 type DexClass struct {
-	Name   string `json:"name"`
-	Size   int64  `json:"size"`
-	Shasum string `json:"shasum"`
+	Name        string `json:"name"`
+	Size        int64  `json:"size"`
+	Shasum      string `json:"shasum"`
+	MethodCount int    `json:"method_count"`
+	FieldCount  int    `json:"field_count"`
+	StringCount int    `json:"string_count"`
+
+	// ObfuscatedName is the name R8 or ProGuard renamed the class to, when a mapping was given
+	ObfuscatedName string `json:"obfuscated_name,omitempty"`
 }
 
 type DexPackage struct {
 	Name    string     `json:"name"`
 	Size    int64      `json:"size"`
 	Classes []DexClass `json:"classes"`
+
+	// DexFile is the path of the .dex file in the file tree the classes are defined in
+	DexFile string `json:"dex_file,omitempty"`
 }
 
-func generateDecompiledCode(dexFilePath string) (string, error) {
-	// Check if jadx is available
-	tempDir, err := os.MkdirTemp("", "*")
+// Fixed item sizes of the DEX format
+const (
+	dexHeaderSize   = 0x70
+	dexClassDefSize = 32
+	dexTypeIDSize   = 4
+	dexStringIDSize = 4
+	dexMemberIDSize = 8
+	dexNoIndex      = 0xffffffff
+)
 
-	if err != nil {
-		return "", fmt.Errorf("failed to create temp dir: %v", err)
+// dexFile is a parsed view over the raw bytes of a .dex file
+type dexFile struct {
+	data         []byte
+	stringIDsOff uint32
+	stringIDs    uint32
+	typeIDsOff   uint32
+	typeIDs      uint32
+	fieldIDsOff  uint32
+	fieldIDs     uint32
+	methodIDsOff uint32
+	methodIDs    uint32
+	classDefsOff uint32
+	classDefs    uint32
+}
+
+// dexClassUsage collects what a single class definition occupies in the file
+type dexClassUsage struct {
+	name        string
+	size        int64
+	methodCount int
+	fieldCount  int
+	strings     map[uint32]bool
+	hash        []byte
+}
+
+func parseDexFile(data []byte) (*dexFile, error) {
+	if len(data) < dexHeaderSize || string(data[:4]) != "dex\n" {
+		return nil, fmt.Errorf("not a DEX file")
 	}
 
-	// Run jadx to decompile the APK
-	cmd := exec.Command("jadx",
-		"--no-res", // Skip resources
-		"--output-dir", tempDir,
-		dexFilePath)
+	le := binary.LittleEndian
+	if le.Uint32(data[0x28:]) != 0x12345678 {
+		return nil, fmt.Errorf("unsupported DEX byte order")
+	}
 
-	err = cmd.Run()
-	if err != nil {
-		// Skip this error as most of the time jadx will fail to decompile some classes
-		// but we still want to analyze the rest of the classes
-		fmt.Println("Some error returned, but continuing for:", dexFilePath)
+	dex := &dexFile{
+		data:         data,
+		stringIDs:    le.Uint32(data[0x38:]),
+		stringIDsOff: le.Uint32(data[0x3c:]),
+		typeIDs:      le.Uint32(data[0x40:]),
+		typeIDsOff:   le.Uint32(data[0x44:]),
+		fieldIDs:     le.Uint32(data[0x50:]),
+		fieldIDsOff:  le.Uint32(data[0x54:]),
+		methodIDs:    le.Uint32(data[0x58:]),
+		methodIDsOff: le.Uint32(data[0x5c:]),
+		classDefs:    le.Uint32(data[0x60:]),
+		classDefsOff: le.Uint32(data[0x64:]),
+	}
+
+	tables := [][3]uint32{
+		{dex.stringIDsOff, dex.stringIDs, dexStringIDSize},
+		{dex.typeIDsOff, dex.typeIDs, dexTypeIDSize},
+		{dex.fieldIDsOff, dex.fieldIDs, dexMemberIDSize},
+		{dex.methodIDsOff, dex.methodIDs, dexMemberIDSize},
+		{dex.classDefsOff, dex.classDefs, dexClassDefSize},
+	}
+	for _, table := range tables {
+		if uint64(table[0])+uint64(table[1])*uint64(table[2]) > uint64(len(data)) {
+			return nil, fmt.Errorf("DEX table out of bounds")
+		}
 	}
 
-	return tempDir, nil
+	return dex, nil
 }
 
-func analyzeDexFiles(unzipedApkDir string) ([]DexPackage, error) {
-	allPackages := []DexPackage{}
+func (d *dexFile) u16(offset uint64) uint16 {
+	if offset+2 > uint64(len(d.data)) {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(d.data[offset:])
+}
 
-	// Walk through the APK path directory
-	err := filepath.Walk(unzipedApkDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+func (d *dexFile) u32(offset uint64) uint32 {
+	if offset+4 > uint64(len(d.data)) {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(d.data[offset:])
+}
 
-		// Skip directories
-		if info.IsDir() {
-			return nil
+// uleb128 decodes an unsigned LEB128 value and returns it with the offset following it
+func (d *dexFile) uleb128(offset uint64) (uint32, uint64) {
+	var result uint32
+	for shift := uint(0); shift < 35; shift += 7 {
+		if offset >= uint64(len(d.data)) {
+			return result, offset
+		}
+		b := d.data[offset]
+		offset++
+		result |= uint32(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
 		}
+	}
+	return result, offset
+}
 
-		// Find any *.dex file
-		if filepath.Ext(path) == ".dex" {
-			// Call generateDecompiledCode on each dex file
-			decompiledCodeDir, err := generateDecompiledCode(path)
-			if err != nil {
-				// Log the error but continue with other dex files
-				fmt.Printf("Failed to decompile DEX file %s: %v\n", path, err)
-				return nil
+// sleb128 decodes a signed LEB128 value and returns it with the offset following it
+func (d *dexFile) sleb128(offset uint64) (int32, uint64) {
+	var result int32
+	var shift uint
+	for shift < 35 {
+		if offset >= uint64(len(d.data)) {
+			return result, offset
+		}
+		b := d.data[offset]
+		offset++
+		result |= int32(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			if shift < 32 && b&0x40 != 0 {
+				result |= -1 << shift
 			}
+			break
+		}
+	}
+	return result, offset
+}
 
-			// // Analyze the decompiled code and get packages
-			packages, err := analyzeDecompiledCode(decompiledCodeDir)
-			if err != nil {
-				fmt.Printf("Warning: failed to analyze decompiled code for %s: %v\n", path, err)
-				return nil
-			}
+// stringDataSize returns the size of the string_data_item of the given string
+func (d *dexFile) stringDataSize(index uint32) int64 {
+	if index >= d.stringIDs {
+		return 0
+	}
+	start := uint64(d.u32(uint64(d.stringIDsOff) + uint64(index)*dexStringIDSize))
+	if start >= uint64(len(d.data)) {
+		return 0
+	}
+	_, offset := d.uleb128(start)
+	for offset < uint64(len(d.data)) && d.data[offset] != 0 {
+		offset++
+	}
+	return int64(offset-start) + 1
+}
 
-			// Merge packages with existing results
-			allPackages = append(allPackages, packages...)
+// stringAt returns the MUTF-8 string with the given index
+func (d *dexFile) stringAt(index uint32) string {
+	if index >= d.stringIDs {
+		return ""
+	}
+	start := uint64(d.u32(uint64(d.stringIDsOff) + uint64(index)*dexStringIDSize))
+	if start >= uint64(len(d.data)) {
+		return ""
+	}
+	_, offset := d.uleb128(start)
+	end := offset
+	for end < uint64(len(d.data)) && d.data[end] != 0 {
+		end++
+	}
+	return string(d.data[offset:end])
+}
+
+// typeDescriptorIndex returns the string index of the given type's descriptor
+func (d *dexFile) typeDescriptorIndex(typeIdx uint32) uint32 {
+	if typeIdx >= d.typeIDs {
+		return dexNoIndex
+	}
+	return d.u32(uint64(d.typeIDsOff) + uint64(typeIdx)*dexTypeIDSize)
+}
+
+// codeItemSize returns the size of the code_item at the given offset and
+// calls fn with every string index loaded by its instructions
+func (d *dexFile) codeItemSize(offset uint64, fn func(stringIdx uint32)) uint64 {
+	triesSize := uint64(d.u16(offset + 6))
+	insnsSize := uint64(d.u32(offset + 12))
+	insns := offset + 16
+	if insns+insnsSize*2 > uint64(len(d.data)) {
+		return 0
+	}
+
+	// Scan the instructions for const-string references
+	for pc := uint64(0); pc < insnsSize; {
+		unit := d.u16(insns + pc*2)
+		opcode := unit & 0xff
+		switch {
+		case opcode == 0x1a:
+			fn(uint32(d.u16(insns + pc*2 + 2)))
+		case opcode == 0x1b:
+			fn(d.u32(insns + pc*2 + 2))
 		}
 
-		return nil
-	})
+		width := uint64(dexInstructionWidths[opcode])
+		if opcode == 0x00 {
+			switch unit {
+			case 0x0100: // packed-switch-payload
+				width = uint64(d.u16(insns+pc*2+2))*2 + 4
+			case 0x0200: // sparse-switch-payload
+				width = uint64(d.u16(insns+pc*2+2))*4 + 2
+			case 0x0300: // fill-array-data-payload
+				elementWidth := uint64(d.u16(insns + pc*2 + 2))
+				count := uint64(d.u32(insns + pc*2 + 4))
+				width = (count*elementWidth+1)/2 + 4
+			}
+		}
+		pc += width
+	}
 
-	if err != nil {
-		return nil, fmt.Errorf("error walking through extracted APK directory: %v", err)
+	end := insns + insnsSize*2
+	if triesSize > 0 {
+		if insnsSize%2 == 1 {
+			end += 2
+		}
+		end += triesSize * 8
+
+		// encoded_catch_handler_list, counts past the end of the file are cut short
+		handlers, next := d.uleb128(end)
+		end = next
+		for i := uint32(0); i < handlers && end < uint64(len(d.data)); i++ {
+			count, next := d.sleb128(end)
+			end = next
+			pairs := count
+			if pairs < 0 {
+				pairs = -pairs
+			}
+			for j := int32(0); j < pairs && end < uint64(len(d.data)); j++ {
+				_, end = d.uleb128(end)
+				_, end = d.uleb128(end)
+			}
+			if count <= 0 {
+				_, end = d.uleb128(end)
+			}
+		}
 	}
 
-	return allPackages, nil
+	return end - offset
 }
 
-func analyzeDecompiledCode(decompiledCodeDir string) ([]DexPackage, error) {
-	dexPackages := []DexPackage{}
+// encodedValueEnd returns the offset following the encoded_value at the given offset
+func (d *dexFile) encodedValueEnd(offset uint64, depth int) uint64 {
+	if offset >= uint64(len(d.data)) || depth > 32 {
+		return offset
+	}
+	header := d.data[offset]
+	valueType := header & 0x1f
+	valueArg := uint64(header >> 5)
+	offset++
+
+	switch valueType {
+	case 0x1c: // VALUE_ARRAY
+		return d.encodedArrayEnd(offset, depth+1)
+	case 0x1d: // VALUE_ANNOTATION
+		_, offset = d.uleb128(offset)
+		size, next := d.uleb128(offset)
+		offset = next
+		for i := uint32(0); i < size && offset < uint64(len(d.data)); i++ {
+			_, offset = d.uleb128(offset)
+			offset = d.encodedValueEnd(offset, depth+1)
+		}
+		return offset
+	case 0x1e, 0x1f: // VALUE_NULL, VALUE_BOOLEAN
+		return offset
+	}
 
-	// Check if the sources directory exists
-	sourcesDir := filepath.Join(decompiledCodeDir, "sources")
-	if _, err := os.Stat(sourcesDir); os.IsNotExist(err) {
-		return nil, fmt.Errorf("sources directory not found in decompiled code")
+	return offset + valueArg + 1
+}
+
+// encodedArrayEnd returns the offset following the encoded_array at the given offset
+func (d *dexFile) encodedArrayEnd(offset uint64, depth int) uint64 {
+	size, offset := d.uleb128(offset)
+	for i := uint32(0); i < size && offset < uint64(len(d.data)); i++ {
+		offset = d.encodedValueEnd(offset, depth)
 	}
+	return offset
+}
 
-	// Analyze the decompiled sources
-	err := filepath.Walk(sourcesDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil
+// classUsages attributes the bytes of the file to every class definition
+func (d *dexFile) classUsages() []dexClassUsage {
+	usages := make([]dexClassUsage, d.classDefs)
+	classByType := make(map[uint32]int, d.classDefs)
+
+	for i := uint32(0); i < d.classDefs; i++ {
+		def := uint64(d.classDefsOff) + uint64(i)*dexClassDefSize
+		classIdx := d.u32(def)
+		classByType[classIdx] = int(i)
+
+		usage := &usages[i]
+		usage.strings = make(map[uint32]bool)
+		usage.size = dexClassDefSize + dexTypeIDSize
+
+		hash := sha256.New()
+		addString := func(index uint32) {
+			if index != dexNoIndex && index < d.stringIDs {
+				usage.strings[index] = true
+			}
 		}
 
-		// Skip directories
-		if info.IsDir() {
-			return nil
+		descriptor := d.typeDescriptorIndex(classIdx)
+		usage.name = d.stringAt(descriptor)
+		// Classes without code would otherwise all share the same hash
+		hash.Write([]byte(usage.name))
+		addString(descriptor)
+		addString(d.u32(def + 16))
+
+		// Implemented interfaces type_list
+		if interfacesOff := uint64(d.u32(def + 12)); interfacesOff != 0 {
+			usage.size += 4 + int64(d.u32(interfacesOff))*2
 		}
 
-		classPath, err := filepath.Rel(sourcesDir, path)
-		if err != nil {
-			return fmt.Errorf("failed to get relative path: %v", err)
+		// Annotations directory, without the annotation sets it points to
+		if annotationsOff := uint64(d.u32(def + 20)); annotationsOff != 0 {
+			entries := int64(d.u32(annotationsOff+4)) + int64(d.u32(annotationsOff+8)) + int64(d.u32(annotationsOff+12))
+			usage.size += 16 + entries*8
 		}
 
-		packagePath := filepath.Dir(classPath)
-		className := strings.TrimSuffix(filepath.Base(classPath), ".java")
-		size := info.Size()
-		checksum, err := calculateSHA256(path)
-		if err != nil {
-			return fmt.Errorf("failed to calculate SHA256 for %s: %v", path, err)
+		// Static field initial values
+		if staticValuesOff := uint64(d.u32(def + 28)); staticValuesOff != 0 {
+			end := d.encodedArrayEnd(staticValuesOff, 0)
+			usage.size += int64(end - staticValuesOff)
 		}
-		fmt.Println("Package:", packagePath, "class:", className, "size:", size)
 
-		// Try to find the package in the slice
-		var pkgIdx int = -1
-		for i := range dexPackages {
-			if dexPackages[i].Name == packagePath {
-				pkgIdx = i
-				break
+		// class_data_item with its fields, methods and their code
+		if classDataOff := uint64(d.u32(def + 24)); classDataOff != 0 {
+			offset := classDataOff
+			var counts [4]uint32
+			for j := range counts {
+				counts[j], offset = d.uleb128(offset)
+			}
+			usage.fieldCount = int(counts[0] + counts[1])
+			usage.methodCount = int(counts[2] + counts[3])
+
+			for j := uint32(0); j < counts[0]+counts[1] && offset < uint64(len(d.data)); j++ {
+				_, offset = d.uleb128(offset)
+				_, offset = d.uleb128(offset)
+			}
+			for _, methodCount := range counts[2:] {
+				for j := uint32(0); j < methodCount && offset < uint64(len(d.data)); j++ {
+					_, offset = d.uleb128(offset)
+					_, offset = d.uleb128(offset)
+					var codeOff uint32
+					codeOff, offset = d.uleb128(offset)
+					if codeOff != 0 {
+						size := d.codeItemSize(uint64(codeOff), addString)
+						if uint64(codeOff)+size <= uint64(len(d.data)) {
+							hash.Write(d.data[codeOff : uint64(codeOff)+size])
+						}
+						usage.size += int64(size)
+					}
+				}
+			}
+
+			if offset <= uint64(len(d.data)) {
+				hash.Write(d.data[classDataOff:offset])
 			}
+			usage.size += int64(offset - classDataOff)
+		}
+
+		usage.hash = hash.Sum(nil)
+	}
+
+	// Field and method identifiers belong to the class that declares them
+	memberTables := [][2]uint32{{d.fieldIDsOff, d.fieldIDs}, {d.methodIDsOff, d.methodIDs}}
+	for _, table := range memberTables {
+		for i := uint32(0); i < table[1]; i++ {
+			member := uint64(table[0]) + uint64(i)*dexMemberIDSize
+			if idx, ok := classByType[uint32(d.u16(member))]; ok {
+				usages[idx].size += dexMemberIDSize
+				usages[idx].strings[d.u32(member+4)] = true
+			}
+		}
+	}
+
+	// Strings are shared, split their size between the classes using them
+	references := make(map[uint32]int)
+	for i := range usages {
+		for index := range usages[i].strings {
+			references[index]++
+		}
+	}
+	for i := range usages {
+		for index := range usages[i].strings {
+			size := d.stringDataSize(index) + dexStringIDSize
+			usages[i].size += size / int64(references[index])
 		}
-		if pkgIdx == -1 {
+	}
+
+	return usages
+}
+
+// dexInstructionWidths holds the size of every opcode in 16-bit code units
+var dexInstructionWidths = func() [256]uint8 {
+	var widths [256]uint8
+	ranges := []struct {
+		from, to uint8
+		width    uint8
+	}{
+		{0x00, 0x01, 1}, {0x02, 0x02, 2}, {0x03, 0x03, 3}, {0x04, 0x04, 1},
+		{0x05, 0x05, 2}, {0x06, 0x06, 3}, {0x07, 0x07, 1}, {0x08, 0x08, 2},
+		{0x09, 0x09, 3}, {0x0a, 0x12, 1}, {0x13, 0x13, 2}, {0x14, 0x14, 3},
+		{0x15, 0x16, 2}, {0x17, 0x17, 3}, {0x18, 0x18, 5}, {0x19, 0x1a, 2},
+		{0x1b, 0x1b, 3}, {0x1c, 0x1c, 2}, {0x1d, 0x1e, 1}, {0x1f, 0x20, 2},
+		{0x21, 0x21, 1}, {0x22, 0x23, 2}, {0x24, 0x26, 3}, {0x27, 0x28, 1},
+		{0x29, 0x29, 2}, {0x2a, 0x2c, 3}, {0x2d, 0x3d, 2}, {0x3e, 0x43, 1},
+		{0x44, 0x6d, 2}, {0x6e, 0x72, 3}, {0x73, 0x73, 1}, {0x74, 0x78, 3},
+		{0x79, 0x8f, 1}, {0x90, 0xaf, 2}, {0xb0, 0xcf, 1}, {0xd0, 0xe2, 2},
+		{0xe3, 0xf9, 1}, {0xfa, 0xfb, 4}, {0xfc, 0xfd, 3}, {0xfe, 0xff, 2},
+	}
+	for _, r := range ranges {
+		for op := int(r.from); op <= int(r.to); op++ {
+			widths[op] = r.width
+		}
+	}
+	return widths
+}()
+
+// analyzeDexFile parses a single .dex file and groups its classes by package
+func analyzeDexFile(fsys fs.FS, name string, mapping *proguardMapping) ([]DexPackage, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DEX file: %v", err)
+	}
+
+	dex, err := parseDexFile(data)
+	if err != nil {
+		return nil, err
+	}
+
+	dexPackages := []DexPackage{}
+	packageIndex := make(map[string]int)
+
+	for _, usage := range dex.classUsages() {
+		// Obfuscated classes are grouped by their original package
+		descriptor := usage.name
+		obfuscatedName := descriptorClassName(descriptor)
+		if original := mapping.deobfuscateClass(obfuscatedName); original != obfuscatedName {
+			descriptor = "L" + strings.ReplaceAll(original, ".", "/") + ";"
+		} else {
+			obfuscatedName = ""
+		}
+		packageName, className := splitClassDescriptor(descriptor)
+
+		// Try to find the package in the slice
+		pkgIdx, ok := packageIndex[packageName]
+		if !ok {
 			// Not found, create a new one and append
 			dexPackages = append(dexPackages, DexPackage{
-				Name:    packagePath,
+				Name:    packageName,
 				Size:    0,
 				Classes: make([]DexClass, 0),
 			})
 			pkgIdx = len(dexPackages) - 1
+			packageIndex[packageName] = pkgIdx
 		}
 
 		// Add the class to the package via slice index
 		dexPackages[pkgIdx].Classes = append(dexPackages[pkgIdx].Classes, DexClass{
-			Name:   className,
-			Size:   size,
-			Shasum: checksum,
+			Name:        className,
+			Size:        usage.size,
+			Shasum:      hex.EncodeToString(usage.hash),
+			MethodCount: usage.methodCount,
+			FieldCount:  usage.fieldCount,
+			StringCount: len(usage.strings),
+
+			ObfuscatedName: obfuscatedName,
 		})
-		dexPackages[pkgIdx].Size += size
+		dexPackages[pkgIdx].Size += usage.size
+	}
+
+	// Sort by size in descending order
+	sort.Slice(dexPackages, func(i, j int) bool {
+		return dexPackages[i].Size > dexPackages[j].Size
+	})
+
+	return dexPackages, nil
+}
+
+// splitClassDescriptor turns "Lcom/example/Foo;" into the package "com.example" and class "Foo"
+func splitClassDescriptor(descriptor string) (string, string) {
+	name := strings.TrimSuffix(strings.TrimPrefix(descriptor, "L"), ";")
+	idx := strings.LastIndex(name, "/")
+	if idx == -1 {
+		return "default", name
+	}
+	return strings.ReplaceAll(name[:idx], "/", "."), name[idx+1:]
+}
+
+// descriptorClassName turns "Lcom/example/Foo;" into "com.example.Foo", the form mappings use
+func descriptorClassName(descriptor string) string {
+	return strings.ReplaceAll(strings.TrimSuffix(strings.TrimPrefix(descriptor, "L"), ";"), "/", ".")
+}
+
+// analyzeDexFiles analyzes every .dex file, restoring the class names of the mapping when one is given
+func analyzeDexFiles(fsys fs.FS, mapping *proguardMapping) ([]DexPackage, error) {
+	allPackages := []DexPackage{}
+
+	// Walk through the APK
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Skip directories
+		if entry.IsDir() {
+			return nil
+		}
+
+		// Find any *.dex file
+		if path.Ext(name) == ".dex" {
+			packages, err := analyzeDexFile(fsys, name, mapping)
+			if err != nil {
+				// Log the error but continue with other dex files
+				fmt.Printf("Warning: failed to analyze DEX file %s: %v\n", name, err)
+				return nil
+			}
+
+			// Merge packages with existing results
+			for i := range packages {
+				packages[i].DexFile = name
+			}
+			allPackages = append(allPackages, packages...)
+		}
 
 		return nil
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("error walking through dex file directory: %v", err)
+		return nil, fmt.Errorf("error walking through APK: %v", err)
 	}
 
-	return dexPackages, nil
+	return allPackages, nil
+}
+
+// dexPackageNodes returns the package hierarchy of a .dex file, like com → com.example → com.example.feature,
+// with the classes of every package as leaves
+func dexPackageNodes(dexPath string, packages []DexPackage) []FileInfo {
+	root := &FileInfo{RelativePath: dexPath}
+	for _, pkg := range packages {
+		if pkg.DexFile != dexPath {
+			continue
+		}
+
+		node := root
+		components := strings.Split(pkg.Name, ".")
+		for i := range components {
+			node = dexPackageNode(node, strings.Join(components[:i+1], "."))
+		}
+		for _, class := range pkg.Classes {
+			node.Children = append(node.Children, FileInfo{
+				RelativePath: path.Join(node.RelativePath, class.Name),
+				Size:         class.Size,
+				Shasum:       class.Shasum,
+				Type:         "dex_class",
+			})
+		}
+	}
+
+	sumDexPackageSizes(root)
+	return root.Children
 }
 
-// // Helper function to add a class to the package tree
-// func addClassToPackageTree(packages *[]DexPackage, packagePath, className string, size int64) {
-// 	// Handle empty package (default package)
-// 	if packagePath == "." {
-// 		packagePath = "default"
-// 	}
-
-// 	// Split the package path into components
-// 	components := strings.Split(packagePath, ".")
-
-// 	// Start at the root level
-// 	currentLevel := packages
-// 	var currentPath string
-
-// 	// Navigate through the package hierarchy
-// 	for i, component := range components {
-// 		if currentPath == "" {
-// 			currentPath = component
-// 		} else {
-// 			currentPath = currentPath + "." + component
-// 		}
-
-// 		// Find or create the package at this level
-// 		var pkg *DexPackage
-// 		for i := range *currentLevel {
-// 			if (*currentLevel)[i].Name == currentPath {
-// 				pkg = &(*currentLevel)[i]
-// 				break
-// 			}
-// 		}
-
-// 		// Create new package if not found
-// 		if pkg == nil {
-// 			*currentLevel = append(*currentLevel, DexPackage{
-// 				Name:     currentPath,
-// 				Size:     0,
-// 				Classes:  make([]DexClass, 0),
-// 				Children: make([]DexPackage, 0),
-// 			})
-// 			pkg = &(*currentLevel)[len(*currentLevel)-1]
-// 		}
-
-// 		// Add the class size to this package level
-// 		pkg.Size += size
-
-// 		// If this is the last component, add the class to this package
-// 		if i == len(components)-1 {
-// 			pkg.Classes = append(pkg.Classes, DexClass{
-// 				Name: className,
-// 				Size: size,
-// 			})
-// 		}
-
-// 		// Move to the next level in the hierarchy
-// 		currentLevel = &pkg.Children
-// 	}
-// }
+// dexPackageNode returns the child package of the node, which is added when missing
+func dexPackageNode(node *FileInfo, name string) *FileInfo {
+	packagePath := path.Join(node.RelativePath, name)
+	for i := range node.Children {
+		if node.Children[i].RelativePath == packagePath {
+			return &node.Children[i]
+		}
+	}
+
+	node.Children = append(node.Children, FileInfo{
+		RelativePath: packagePath,
+		Type:         "dex_package",
+		Children:     make([]FileInfo, 0),
+	})
+	return &node.Children[len(node.Children)-1]
+}
+
+// sumDexPackageSizes sets the size of every package to the size of its classes and subpackages
+func sumDexPackageSizes(node *FileInfo) int64 {
+	if node.Type == "dex_class" {
+		return node.Size
+	}
+
+	node.Size = 0
+	for i := range node.Children {
+		node.Size += sumDexPackageSizes(&node.Children[i])
+	}
+	return node.Size
+}
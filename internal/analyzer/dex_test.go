@@ -0,0 +1,280 @@
+package analyzer
+
+import (
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// testDexClass is a class definition of testDexFile, code is the instructions of its only direct method
+type testDexClass struct {
+	typeIdx uint32
+	code    []uint16
+	tries   []byte
+}
+
+// testDexFile lays out the header, the string data, the identifier tables and the class definitions,
+// then the class data and code of every class, methods holds the type and name string of every method_id
+func testDexFile(strs []string, types []uint32, methods [][2]uint32, classes []testDexClass) []byte {
+	le := binary.LittleEndian
+	data := make([]byte, dexHeaderSize)
+
+	stringOffsets := make([]uint32, len(strs))
+	for i, s := range strs {
+		stringOffsets[i] = uint32(len(data))
+		data = binary.AppendUvarint(data, uint64(len(s)))
+		data = append(data, s...)
+		data = append(data, 0)
+	}
+	for len(data)%4 != 0 {
+		data = append(data, 0)
+	}
+
+	table := func(offsetField int, count int, fn func()) {
+		le.PutUint32(data[offsetField-4:], uint32(count))
+		le.PutUint32(data[offsetField:], uint32(len(data)))
+		fn()
+	}
+	table(0x3c, len(strs), func() {
+		for _, offset := range stringOffsets {
+			data = le.AppendUint32(data, offset)
+		}
+	})
+	table(0x44, len(types), func() {
+		for _, descriptor := range types {
+			data = le.AppendUint32(data, descriptor)
+		}
+	})
+	table(0x5c, len(methods), func() {
+		for _, method := range methods {
+			data = le.AppendUint16(data, uint16(method[0]))
+			data = le.AppendUint16(data, 0)
+			data = le.AppendUint32(data, method[1])
+		}
+	})
+
+	var classDefs []int
+	table(0x64, len(classes), func() {
+		for _, class := range classes {
+			classDefs = append(classDefs, len(data))
+			data = le.AppendUint32(data, class.typeIdx)
+			data = append(data, make([]byte, 8)...)
+			data = le.AppendUint32(data, 0)
+			data = le.AppendUint32(data, dexNoIndex)
+			data = append(data, make([]byte, 12)...)
+		}
+	})
+
+	for i, class := range classes {
+		if class.code == nil {
+			continue
+		}
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+		codeOff := len(data)
+		data = le.AppendUint16(data, 1)
+		data = le.AppendUint16(data, 0)
+		data = le.AppendUint16(data, 0)
+		data = le.AppendUint16(data, uint16(min(len(class.tries), 1)))
+		data = le.AppendUint32(data, 0)
+		data = le.AppendUint32(data, uint32(len(class.code)))
+		for _, unit := range class.code {
+			data = le.AppendUint16(data, unit)
+		}
+		data = append(data, class.tries...)
+
+		le.PutUint32(data[classDefs[i]+24:], uint32(len(data)))
+		data = append(data, 0, 0, 1, 0)
+		data = append(data, 0, 1)
+		data = binary.AppendUvarint(data, uint64(codeOff))
+	}
+
+	copy(data, "dex\n035\x00")
+	le.PutUint32(data[0x20:], uint32(len(data)))
+	le.PutUint32(data[0x24:], dexHeaderSize)
+	le.PutUint32(data[0x28:], 0x12345678)
+	return data
+}
+
+// testDex holds com.example.Foo, whose method loads a string, com.example.Bar and Top, which have no code
+func testDex() []byte {
+	return testDexFile(
+		[]string{"Lcom/example/Foo;", "Lcom/example/Bar;", "hello", "run", "LTop;"},
+		[]uint32{0, 1, 4},
+		[][2]uint32{{0, 3}},
+		[]testDexClass{
+			// const-string v0, "hello"; return-void
+			{typeIdx: 0, code: []uint16{0x001a, 0x0002, 0x000e}},
+			{typeIdx: 1},
+			{typeIdx: 2},
+		},
+	)
+}
+
+func TestAnalyzeDexFile(t *testing.T) {
+	type class struct {
+		pkg, name, obfuscatedName     string
+		size                          int64
+		methods, fields, stringsCount int
+	}
+
+	tests := []struct {
+		name    string
+		mapping *proguardMapping
+		want    []class
+	}{
+		{
+			name: "without mapping",
+			want: []class{
+				// class_def and type_id, code_item, class_data_item, method_id, then the strings
+				// "Lcom/example/Foo;", "hello" and "run" with their string_id
+				{"com.example", "Foo", "", 32 + 4 + 22 + 8 + 8 + 23 + 11 + 9, 1, 0, 3},
+				{"com.example", "Bar", "", 32 + 4 + 23, 0, 0, 1},
+				{"default", "Top", "", 32 + 4 + 11, 0, 0, 1},
+			},
+		},
+		{
+			name:    "with mapping",
+			mapping: &proguardMapping{classes: map[string]string{"Top": "com.example.Renamed"}},
+			want: []class{
+				{"com.example", "Foo", "", 117, 1, 0, 3},
+				{"com.example", "Bar", "", 59, 0, 0, 1},
+				{"com.example", "Renamed", "Top", 47, 0, 0, 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{"classes.dex": {Data: testDex()}}
+			packages, err := analyzeDexFile(fsys, "classes.dex", tt.mapping)
+			if err != nil {
+				t.Fatalf("analyzeDexFile() error = %v", err)
+			}
+
+			var got []class
+			shasums := make(map[string]bool)
+			for _, pkg := range packages {
+				var size int64
+				for _, c := range pkg.Classes {
+					got = append(got, class{pkg.Name, c.Name, c.ObfuscatedName, c.Size, c.MethodCount, c.FieldCount, c.StringCount})
+					shasums[c.Shasum] = true
+					size += c.Size
+				}
+				if size != pkg.Size {
+					t.Errorf("package %s has size %d, its classes %d", pkg.Name, pkg.Size, size)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("analyzeDexFile() classes = %v, want %v", got, tt.want)
+			}
+			// Classes without code are told apart by their descriptor
+			if len(shasums) != len(got) {
+				t.Errorf("analyzeDexFile() classes share shasums: %v", shasums)
+			}
+		})
+	}
+}
+
+func TestParseDexFileMalformed(t *testing.T) {
+	dex := testDex()
+
+	bigEndian := append([]byte{}, dex...)
+	binary.BigEndian.PutUint32(bigEndian[0x28:], 0x12345678)
+
+	tooManyClasses := append([]byte{}, dex...)
+	binary.LittleEndian.PutUint32(tooManyClasses[0x60:], 0x10000000)
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{name: "header cut short", data: dex[:dexHeaderSize-1], want: "not a DEX file"},
+		{name: "wrong magic", data: append([]byte("dey\n"), dex[4:]...), want: "not a DEX file"},
+		{name: "big endian", data: bigEndian, want: "unsupported DEX byte order"},
+		{name: "class defs past the end", data: tooManyClasses, want: "DEX table out of bounds"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseDexFile(tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseDexFile() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDexClassUsagesMalformed(t *testing.T) {
+	le := binary.LittleEndian
+
+	// The string_id of "Lcom/example/Foo;" points past the end of the file
+	stringPastEnd := testDex()
+	le.PutUint32(stringPastEnd[le.Uint32(stringPastEnd[0x3c:]):], 0xfffffff0)
+
+	// A try block followed by a catch handler list claiming billions of handlers
+	tries := append(make([]byte, 2+8), 0xff, 0xff, 0xff, 0xff, 0x0f)
+	handlersPastEnd := testDexFile([]string{"LFoo;"}, []uint32{0}, [][2]uint32{{0, 0}},
+		[]testDexClass{{typeIdx: 0, code: []uint16{0x000e}, tries: tries}})
+
+	// A class_data_item claiming billions of fields at the end of the file
+	fieldsPastEnd := testDexFile([]string{"LFoo;"}, []uint32{0}, nil, []testDexClass{{typeIdx: 0}})
+	le.PutUint32(fieldsPastEnd[le.Uint32(fieldsPastEnd[0x64:])+24:], uint32(len(fieldsPastEnd)))
+	fieldsPastEnd = append(fieldsPastEnd, 0xff, 0xff, 0xff, 0xff, 0x0f)
+	le.PutUint32(fieldsPastEnd[0x20:], uint32(len(fieldsPastEnd)))
+
+	// The class_data_item of Foo follows its code_item, files cut inside of either still list every class
+	dex := testDex()
+	classData := le.Uint32(dex[le.Uint32(dex[0x64:])+24:])
+	codeOff := classData - 4 - 2*3 - 16
+
+	tests := []struct {
+		name      string
+		data      []byte
+		wantNames []string
+	}{
+		{name: "string past the end", data: stringPastEnd, wantNames: []string{"", "Lcom/example/Bar;", "LTop;"}},
+		{name: "code cut short", data: dex[:codeOff+16+2], wantNames: []string{"Lcom/example/Foo;", "Lcom/example/Bar;", "LTop;"}},
+		{name: "class data cut short", data: dex[:classData+3], wantNames: []string{"Lcom/example/Foo;", "Lcom/example/Bar;", "LTop;"}},
+		{name: "catch handlers past the end", data: handlersPastEnd, wantNames: []string{"LFoo;"}},
+		{name: "fields past the end", data: fieldsPastEnd, wantNames: []string{"LFoo;"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dex, err := parseDexFile(tt.data)
+			if err != nil {
+				t.Fatalf("parseDexFile() error = %v", err)
+			}
+			var names []string
+			for _, usage := range dex.classUsages() {
+				names = append(names, usage.name)
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("classUsages() names = %q, want %q", names, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestSplitClassDescriptor(t *testing.T) {
+	tests := []struct {
+		descriptor  string
+		wantPackage string
+		wantClass   string
+	}{
+		{descriptor: "Lcom/example/Foo;", wantPackage: "com.example", wantClass: "Foo"},
+		{descriptor: "Lcom/example/Foo$Bar;", wantPackage: "com.example", wantClass: "Foo$Bar"},
+		{descriptor: "LFoo;", wantPackage: "default", wantClass: "Foo"},
+		{descriptor: "", wantPackage: "default", wantClass: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.descriptor, func(t *testing.T) {
+			pkg, class := splitClassDescriptor(tt.descriptor)
+			if pkg != tt.wantPackage || class != tt.wantClass {
+				t.Errorf("splitClassDescriptor() = %q, %q, want %q, %q", pkg, class, tt.wantPackage, tt.wantClass)
+			}
+		})
+	}
+}
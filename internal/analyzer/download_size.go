@@ -0,0 +1,116 @@
+package analyzer
+
+import (
+	"compress/flate"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// Sizes of the zip records written for every entry and once per archive
+const (
+	zipLocalHeaderSize   = 30
+	zipCentralHeaderSize = 46
+	zipEndRecordSize     = 22
+)
+
+// countingWriter discards everything written to it, only counting the bytes
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// estimateDownloadSize zips the bundle in memory, the way it is packaged for distribution,
+// and stores the compressed contribution of every file in the tree
+func estimateDownloadSize(files *FileInfo, fsys fs.FS, bundleName string) (int64, error) {
+	if err := estimateCompressedSize(files, fsys, bundleName); err != nil {
+		return 0, err
+	}
+
+	return files.CompressedSize + zipEndRecordSize, nil
+}
+
+// estimateCompressedSize sets the compressed size of the node, including its zip headers
+func estimateCompressedSize(node *FileInfo, fsys fs.FS, prefix string) error {
+	name := path.Join(prefix, node.RelativePath)
+	node.CompressedSize = int64(zipLocalHeaderSize + zipCentralHeaderSize + 2*len(name))
+
+	if node.Type == "directory" {
+		for i := range node.Children {
+			child := &node.Children[i]
+			if err := estimateCompressedSize(child, fsys, prefix); err != nil {
+				return err
+			}
+			node.CompressedSize += child.CompressedSize
+		}
+		return nil
+	}
+
+	// Symlinks only store the path of their target
+	if node.Type == "symlink" {
+		return nil
+	}
+
+	size, err := deflatedSize(fsys, node.RelativePath)
+	if err != nil {
+		return fmt.Errorf("failed to compress %s: %v", node.RelativePath, err)
+	}
+
+	// Incompressible files are stored as they are
+	node.CompressedSize += min(size, node.Size)
+	return nil
+}
+
+// deflatedSize returns the size of the file once compressed with deflate
+func deflatedSize(fsys fs.FS, name string) (int64, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	counter := &countingWriter{}
+	writer, err := flate.NewWriter(counter, flate.DefaultCompression)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := io.Copy(writer, file); err != nil {
+		return 0, err
+	}
+	if err := writer.Close(); err != nil {
+		return 0, err
+	}
+
+	return counter.n, nil
+}
+
+// setArchiveCompressedSizes stores the compressed contribution of every file in the tree,
+// as recorded by the central directory of the archive the files are read from
+func setArchiveCompressedSizes(files *FileInfo, archive *archiveFS) {
+	entries := make(map[string]int64, len(archive.archive.reader.File))
+	for _, file := range archive.archive.reader.File {
+		headers := zipLocalHeaderSize + zipCentralHeaderSize + 2*len(file.Name) + 2*len(file.Extra) + len(file.Comment)
+		entries[strings.TrimSuffix(file.Name, "/")] = int64(file.CompressedSize64) + int64(headers)
+	}
+
+	setCompressedSize(files, entries, archive.prefix)
+}
+
+// setCompressedSize sets the compressed size of the node from the archive entries,
+// directories add up the compressed sizes of their contents
+func setCompressedSize(node *FileInfo, entries map[string]int64, prefix string) {
+	name := path.Join(prefix, node.RelativePath)
+	node.CompressedSize = entries[name]
+
+	for i := range node.Children {
+		child := &node.Children[i]
+		setCompressedSize(child, entries, prefix)
+		node.CompressedSize += child.CompressedSize
+	}
+}
@@ -0,0 +1,269 @@
+package analyzer
+
+import (
+	"debug/elf"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// NativeLibrary describes an ELF shared library of an Android app, like lib/arm64-v8a/libfoo.so
+type NativeLibrary struct {
+	Path           string       `json:"path"`
+	Abi            string       `json:"abi"`
+	Size           int64        `json:"size"`
+	CompressedSize int64        `json:"compressed_size,omitempty"`
+	Sections       []ElfSection `json:"sections"`
+	// Stripped is set when the library has no .symtab, only the dynamic symbols are left
+	Stripped bool `json:"stripped"`
+	// DebugInfoSize is the size of the .debug_* sections, which ship DWARF to every device
+	DebugInfoSize int64    `json:"debug_info_size,omitempty"`
+	Needed        []string `json:"needed"`
+	// ExportedSymbols are the largest symbols of the dynamic symbol table other libraries and JNI can use
+	ExportedSymbols     []SymbolSize `json:"exported_symbols"`
+	ExportedSymbolCount int          `json:"exported_symbol_count"`
+	// LargestSymbols are the largest functions and objects, from .symtab or .dynsym when stripped
+	LargestSymbols []SymbolSize `json:"largest_symbols"`
+
+	// LoadAlignment is the smallest alignment of the PT_LOAD segments, which must cover the page size
+	LoadAlignment int64 `json:"load_alignment"`
+	// Compression is "stored" or "deflated", stored libraries can be loaded from the archive directly
+	Compression string `json:"compression,omitempty"`
+	// ZipAlignment is the largest power of two the offset of the data of a stored library is a multiple of
+	ZipOffset    int64 `json:"zip_offset,omitempty"`
+	ZipAlignment int64 `json:"zip_alignment,omitempty"`
+	// PageSizeIssues are the reasons the library can't be loaded on devices with 16 KB pages
+	PageSizeIssues []string `json:"page_size_issues,omitempty"`
+
+	// is64Bit is set for ELFCLASS64 libraries, the only ones loaded on 16 KB page devices
+	is64Bit bool
+}
+
+// ElfSection is a section of an ELF file that occupies space in the file
+type ElfSection struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// NativeAbi sums the native libraries built for an ABI
+type NativeAbi struct {
+	Abi            string `json:"abi"`
+	Libraries      int    `json:"libraries"`
+	Size           int64  `json:"size"`
+	CompressedSize int64  `json:"compressed_size,omitempty"`
+
+	// Supports16KBPages is set when every library of the ABI passes the 16 KB page size checks,
+	// which only apply to 64-bit ABIs, 32-bit libraries aren't loaded on devices with 16 KB pages
+	Supports16KBPages bool `json:"supports_16kb_pages"`
+	Is64Bit           bool `json:"is_64bit"`
+}
+
+// elfMachineAbis maps ELF machines to the Android ABIs, for libraries outside of lib/<abi>
+var elfMachineAbis = map[elf.Machine]string{
+	elf.EM_AARCH64: "arm64-v8a",
+	elf.EM_ARM:     "armeabi-v7a",
+	elf.EM_386:     "x86",
+	elf.EM_X86_64:  "x86_64",
+	elf.EM_RISCV:   "riscv64",
+	elf.EM_MIPS:    "mips",
+}
+
+// analyzeNativeLibraries analyzes the .so files of the tree, files holds the compressed sizes of archives,
+// zipPlacement records how the libraries are stored in archives that are installed as they are
+func analyzeNativeLibraries(fsys fs.FS, files *FileInfo, zipPlacement bool) ([]NativeLibrary, error) {
+	libraries := make([]NativeLibrary, 0)
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !entry.Type().IsRegular() || !strings.HasSuffix(name, ".so") || !isElfFile(fsys, name) {
+			return nil
+		}
+
+		library, err := analyzeNativeLibrary(fsys, name)
+		if err != nil {
+			// Log the error but continue with other libraries
+			fmt.Printf("Warning: failed to analyze native library %s: %v\n", name, err)
+			return nil
+		}
+		if node := findFileInfo(files, name); node != nil {
+			library.CompressedSize = node.CompressedSize
+		}
+		if archive, ok := fsys.(*archiveFS); ok && zipPlacement {
+			setZipPlacement(library, archive, name)
+		}
+
+		libraries = append(libraries, *library)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find native libraries: %v", err)
+	}
+
+	return libraries, nil
+}
+
+// isElfFile reports whether the file starts with the ELF magic
+func isElfFile(fsys fs.FS, name string) bool {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	var magic [4]byte
+	if _, err := io.ReadFull(f, magic[:]); err != nil {
+		return false
+	}
+	return string(magic[:]) == elf.ELFMAG
+}
+
+// analyzeNativeLibrary reads the sections, dependencies and symbols of a shared library
+func analyzeNativeLibrary(fsys fs.FS, name string) (*NativeLibrary, error) {
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := openReaderAt(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ELF: %v", err)
+	}
+
+	library := &NativeLibrary{
+		Path:            name,
+		Abi:             nativeLibraryAbi(name, f.Machine),
+		Size:            info.Size(),
+		Sections:        make([]ElfSection, 0),
+		Stripped:        f.Section(".symtab") == nil,
+		Needed:          make([]string, 0),
+		ExportedSymbols: make([]SymbolSize, 0),
+		LargestSymbols:  make([]SymbolSize, 0),
+		LoadAlignment:   loadAlignment(f),
+		is64Bit:         f.Class == elf.ELFCLASS64,
+	}
+
+	for _, section := range f.Sections {
+		if section.Type == elf.SHT_NULL || section.Type == elf.SHT_NOBITS || section.FileSize == 0 {
+			continue
+		}
+		library.Sections = append(library.Sections, ElfSection{Name: section.Name, Size: int64(section.FileSize)})
+		if strings.HasPrefix(section.Name, ".debug_") || strings.HasPrefix(section.Name, ".zdebug_") {
+			library.DebugInfoSize += int64(section.FileSize)
+		}
+	}
+
+	// DT_NEEDED entries
+	if needed, err := f.ImportedLibraries(); err == nil {
+		library.Needed = append(library.Needed, needed...)
+	}
+
+	dynamicSymbols, err := f.DynamicSymbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return nil, fmt.Errorf("failed to read dynamic symbols: %v", err)
+	}
+	var exported []elf.Symbol
+	for _, symbol := range dynamicSymbols {
+		binding := elf.ST_BIND(symbol.Info)
+		if symbol.Section == elf.SHN_UNDEF || (binding != elf.STB_GLOBAL && binding != elf.STB_WEAK) ||
+			elf.ST_VISIBILITY(symbol.Other) != elf.STV_DEFAULT {
+			continue
+		}
+		exported = append(exported, symbol)
+	}
+	library.ExportedSymbolCount = len(exported)
+	library.ExportedSymbols = largestElfSymbols(f, exported)
+
+	symbols := dynamicSymbols
+	if !library.Stripped {
+		if symbols, err = f.Symbols(); err != nil {
+			return nil, fmt.Errorf("failed to read symbols: %v", err)
+		}
+	}
+	library.LargestSymbols = largestElfSymbols(f, symbols)
+
+	return library, nil
+}
+
+// nativeLibraryAbi returns the ABI of the lib/<abi> directory of the library, or the one of its machine
+func nativeLibraryAbi(name string, machine elf.Machine) string {
+	dir := path.Dir(name)
+	if path.Base(path.Dir(dir)) == "lib" {
+		return path.Base(dir)
+	}
+	if abi, ok := elfMachineAbis[machine]; ok {
+		return abi
+	}
+	return strings.ToLower(strings.TrimPrefix(machine.String(), "EM_"))
+}
+
+// largestElfSymbols returns the largest defined functions and objects, with C++ names demangled
+func largestElfSymbols(f *elf.File, symbols []elf.Symbol) []SymbolSize {
+	sizes := make([]SymbolSize, 0)
+	for _, symbol := range symbols {
+		kind := elf.ST_TYPE(symbol.Info)
+		if symbol.Size == 0 || symbol.Section == elf.SHN_UNDEF || int(symbol.Section) >= len(f.Sections) ||
+			(kind != elf.STT_FUNC && kind != elf.STT_OBJECT) {
+			continue
+		}
+
+		name := symbol.Name
+		if demangled, ok := demangleCpp(symbol.Name); ok {
+			name = demangled.Name
+		}
+		sizes = append(sizes, SymbolSize{
+			Name:        name,
+			MangledName: symbol.Name,
+			Section:     f.Sections[symbol.Section].Name,
+			Size:        int64(symbol.Size),
+		})
+	}
+
+	sort.Slice(sizes, func(i, j int) bool {
+		if sizes[i].Size != sizes[j].Size {
+			return sizes[i].Size > sizes[j].Size
+		}
+		return sizes[i].MangledName < sizes[j].MangledName
+	})
+	if len(sizes) > maxAttributedEntries {
+		sizes = sizes[:maxAttributedEntries]
+	}
+	return sizes
+}
+
+// summarizeNativeAbis sums the native libraries of every ABI, largest first
+func summarizeNativeAbis(libraries []NativeLibrary) []NativeAbi {
+	abis := make([]NativeAbi, 0)
+	index := make(map[string]int)
+	for _, library := range libraries {
+		i, ok := index[library.Abi]
+		if !ok {
+			abis = append(abis, NativeAbi{Abi: library.Abi, Supports16KBPages: true})
+			i = len(abis) - 1
+			index[library.Abi] = i
+		}
+		abis[i].Libraries++
+		abis[i].Size += library.Size
+		abis[i].CompressedSize += library.CompressedSize
+		if len(library.PageSizeIssues) > 0 {
+			abis[i].Supports16KBPages = false
+		}
+		if library.is64Bit {
+			abis[i].Is64Bit = true
+		}
+	}
+
+	sort.SliceStable(abis, func(i, j int) bool {
+		return abis[i].Size > abis[j].Size
+	})
+	return abis
+}
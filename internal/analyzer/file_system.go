@@ -1,42 +1,55 @@
 package analyzer
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
+	"io/fs"
+	"path"
 	"strings"
 )
 
 type FileInfo struct {
-	RelativePath string     `json:"relative_path"`
-	Size         int64      `json:"size"`
-	Shasum       string     `json:"shasum"`
-	Type         string     `json:"type"`
-	Children     []FileInfo `json:"children,omitempty"`
+	RelativePath   string     `json:"relative_path"`
+	Size           int64      `json:"size"`
+	CompressedSize int64      `json:"compressed_size,omitempty"`
+	Shasum         string     `json:"shasum"`
+	Type           string     `json:"type"`
+	Children       []FileInfo `json:"children,omitempty"`
 }
 
-func AnalyzeFile(filePath string, basePath string) (FileInfo, error) {
-	info, err := os.Stat(filePath)
-	if err != nil {
-		return FileInfo{}, fmt.Errorf("failed to get file info: %v", err)
-	}
+// readerAtFile is a file opened for random access, as debug/macho needs it
+type readerAtFile interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// nopCloser turns an in-memory io.ReaderAt into a readerAtFile
+type nopCloser struct {
+	io.ReaderAt
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
 
-	relativePath, err := filepath.Rel(basePath, filePath)
+// AnalyzeFile analyzes the named file or directory of fsys, directories are walked recursively
+func AnalyzeFile(fsys fs.FS, name string) (FileInfo, error) {
+	info, err := fs.Stat(fsys, name)
 	if err != nil {
-		return FileInfo{}, fmt.Errorf("failed to get relative path: %v", err)
+		return FileInfo{}, fmt.Errorf("failed to get file info: %v", err)
 	}
 
 	fileInfo := FileInfo{
-		RelativePath: relativePath,
+		RelativePath: name,
 		Type:         getFileType(info),
 	}
 
 	// Recursively process directory contents
 	if info.IsDir() {
-		entries, err := os.ReadDir(filePath)
+		entries, err := fs.ReadDir(fsys, name)
 		if err != nil {
 			return FileInfo{}, fmt.Errorf("failed to read directory: %v", err)
 		}
@@ -44,8 +57,15 @@ func AnalyzeFile(filePath string, basePath string) (FileInfo, error) {
 		var totalSize int64
 		var childChecksums []string
 		for _, entry := range entries {
-			childPath := filepath.Join(filePath, entry.Name())
-			childInfo, err := AnalyzeFile(childPath, basePath)
+			childPath := path.Join(name, entry.Name())
+
+			// Symlinks, like Versions/Current of macOS frameworks, would count their target twice
+			if entry.Type()&fs.ModeSymlink != 0 {
+				fileInfo.Children = append(fileInfo.Children, FileInfo{RelativePath: childPath, Type: "symlink"})
+				continue
+			}
+
+			childInfo, err := AnalyzeFile(fsys, childPath)
 			if err != nil {
 				return FileInfo{}, err
 			}
@@ -66,7 +86,7 @@ func AnalyzeFile(filePath string, basePath string) (FileInfo, error) {
 	} else {
 		fileInfo.Size = info.Size()
 		// Calculate SHA256 for files
-		shasum, err := calculateSHA256(filePath)
+		shasum, err := calculateSHA256(fsys, name)
 		if err != nil {
 			return FileInfo{}, fmt.Errorf("failed to calculate SHA256: %v", err)
 		}
@@ -76,13 +96,27 @@ func AnalyzeFile(filePath string, basePath string) (FileInfo, error) {
 	return fileInfo, nil
 }
 
-func getFileType(info os.FileInfo) string {
+// findFileInfo returns the node of the tree with the given relative path
+func findFileInfo(root *FileInfo, relativePath string) *FileInfo {
+	if root.RelativePath == relativePath {
+		return root
+	}
+	for i := range root.Children {
+		child := &root.Children[i]
+		if child.RelativePath == relativePath || strings.HasPrefix(relativePath, child.RelativePath+"/") {
+			return findFileInfo(child, relativePath)
+		}
+	}
+	return nil
+}
+
+func getFileType(info fs.FileInfo) string {
 	if info.IsDir() {
 		return "directory"
 	}
 
 	name := strings.ToLower(info.Name())
-	ext := strings.ToLower(filepath.Ext(name))
+	ext := strings.ToLower(path.Ext(name))
 
 	switch ext {
 	// Fonts
@@ -113,8 +147,8 @@ func getFileType(info os.FileInfo) string {
 	}
 }
 
-func calculateSHA256(filePath string) (string, error) {
-	file, err := os.Open(filePath)
+func calculateSHA256(fsys fs.FS, name string) (string, error) {
+	file, err := fsys.Open(name)
 	if err != nil {
 		return "", err
 	}
@@ -127,3 +161,25 @@ func calculateSHA256(filePath string) (string, error) {
 
 	return hex.EncodeToString(hash.Sum(nil)), nil
 }
+
+// openReaderAt opens the named file for random access, archives inflate or extract the entry
+func openReaderAt(fsys fs.FS, name string) (readerAtFile, error) {
+	if archive, ok := fsys.(*archiveFS); ok {
+		return archive.openReaderAt(name)
+	}
+
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if f, ok := file.(readerAtFile); ok {
+		return f, nil
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	return nopCloser{bytes.NewReader(data)}, nil
+}
@@ -0,0 +1,187 @@
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// XCFrameworkSlice is a library of an XCFramework built for one platform
+type XCFrameworkSlice struct {
+	Identifier      string   `json:"identifier"`
+	Platform        string   `json:"platform"`
+	PlatformVariant string   `json:"platform_variant,omitempty"`
+	Architectures   []string `json:"architectures"`
+	LibraryPath     string   `json:"library_path"`
+	// LibraryType is "framework", "static_library" or "dynamic_library"
+	LibraryType    string `json:"library_type"`
+	Size           int64  `json:"size"`
+	CompressedSize int64  `json:"compressed_size,omitempty"`
+	// DebugSymbolsSize is the size of the dSYMs and symbol maps shipped next to the library
+	DebugSymbolsSize int64 `json:"debug_symbols_size,omitempty"`
+	// StaticArchive is set when the binary of the library is an ar archive of object files,
+	// which isn't broken down into segments
+	StaticArchive bool `json:"static_archive,omitempty"`
+}
+
+// analyzeFramework analyzes a .framework bundle shipped on its own
+func analyzeFramework(framework_path string, options Options) (*AppBundle, error) {
+	return AnalyzeAppBundle(os.DirFS(framework_path), filepath.Base(framework_path), "", options)
+}
+
+// analyzeFrameworkBundle reads the Info.plist, asset catalogs and binaries of a framework
+func analyzeFrameworkBundle(fsys fs.FS, bundle *AppBundle) error {
+	readFrameworkInfoPlist(fsys, bundle)
+
+	if err := FindAndAnalyzeCarFiles(fsys, bundle); err != nil {
+		return err
+	}
+
+	return FindAndAnalyzeMachO(fsys, bundle)
+}
+
+// readFrameworkInfoPlist reads the metadata of a framework, unlike apps it is optional
+// as static frameworks often ship without a complete Info.plist
+func readFrameworkInfoPlist(fsys fs.FS, bundle *AppBundle) {
+	// macOS frameworks keep their Info.plist in Resources
+	for _, name := range []string{"Info.plist", "Resources/Info.plist"} {
+		data, err := readInfoPlist(fsys, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			fmt.Printf("Warning: failed to read %s: %v\n", name, err)
+			return
+		}
+
+		bundle.BundleID, _ = data["CFBundleIdentifier"].(string)
+		bundle.Version, _ = data["CFBundleShortVersionString"].(string)
+		bundle.MinimumOSVersion, _ = data["MinimumOSVersion"].(string)
+		if platforms, ok := data["CFBundleSupportedPlatforms"].([]interface{}); ok {
+			for _, platform := range platforms {
+				if str, ok := platform.(string); ok {
+					bundle.SupportedPlatforms = append(bundle.SupportedPlatforms, str)
+				}
+			}
+		}
+		return
+	}
+}
+
+// analyzeXcframework analyzes every library of an .xcframework and breaks its size down per slice
+func analyzeXcframework(xcframework_path string, options Options) (*AppBundle, error) {
+	fsys := os.DirFS(xcframework_path)
+	bundle, err := AnalyzeAppBundle(fsys, filepath.Base(xcframework_path), "", options)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := readInfoPlist(fsys, "Info.plist")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read XCFramework Info.plist: %v", err)
+	}
+	libraries, ok := data["AvailableLibraries"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("AvailableLibraries not found or invalid type")
+	}
+
+	seenPlatforms := make(map[string]bool)
+	bundle.Slices = make([]XCFrameworkSlice, 0, len(libraries))
+	for _, library := range libraries {
+		properties, ok := library.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		slice := readXCFrameworkSlice(properties)
+		if slice.Identifier == "" || !fs.ValidPath(path.Join(slice.Identifier, slice.LibraryPath)) {
+			fmt.Printf("Warning: skipping invalid XCFramework library: %v\n", properties)
+			continue
+		}
+
+		libraryPath := path.Join(slice.Identifier, slice.LibraryPath)
+		if node := findFileInfo(&bundle.Files, libraryPath); node != nil {
+			slice.Size = node.Size
+			slice.CompressedSize = node.CompressedSize
+		}
+		// Headers and modules ship with the library, only the dSYMs and symbol maps are debug symbols
+		for _, name := range []string{"dSYMs", "BCSymbolMaps"} {
+			if node := findFileInfo(&bundle.Files, path.Join(slice.Identifier, name)); node != nil {
+				slice.DebugSymbolsSize += node.Size
+			}
+		}
+		slice.StaticArchive = isStaticArchive(fsys, frameworkBinaryPath(libraryPath))
+
+		// The first framework slice describes the XCFramework
+		if slice.LibraryType == "framework" && bundle.BundleID == "" {
+			if sliceFS, err := fs.Sub(fsys, libraryPath); err == nil {
+				metadata := &AppBundle{}
+				readFrameworkInfoPlist(sliceFS, metadata)
+				bundle.BundleID = metadata.BundleID
+				bundle.Version = metadata.Version
+				bundle.MinimumOSVersion = metadata.MinimumOSVersion
+			}
+		}
+
+		platform := slice.Platform
+		if slice.PlatformVariant != "" {
+			platform += "-" + slice.PlatformVariant
+		}
+		if !seenPlatforms[platform] {
+			seenPlatforms[platform] = true
+			bundle.SupportedPlatforms = append(bundle.SupportedPlatforms, platform)
+		}
+
+		bundle.Slices = append(bundle.Slices, slice)
+	}
+
+	// Asset catalogs and binaries of every slice, the dSYMs next to them are skipped
+	if err := FindAndAnalyzeCarFiles(fsys, bundle); err != nil {
+		return nil, err
+	}
+	if err := FindAndAnalyzeMachO(fsys, bundle); err != nil {
+		return nil, err
+	}
+
+	return bundle, nil
+}
+
+// frameworkBinaryPath returns the path of the binary of a framework, other libraries are binaries themselves
+func frameworkBinaryPath(libraryPath string) string {
+	if !strings.HasSuffix(libraryPath, FrameworkExtension) {
+		return libraryPath
+	}
+	return path.Join(libraryPath, strings.TrimSuffix(path.Base(libraryPath), FrameworkExtension))
+}
+
+// readXCFrameworkSlice reads an entry of the AvailableLibraries of the XCFramework Info.plist
+func readXCFrameworkSlice(properties map[string]interface{}) XCFrameworkSlice {
+	slice := XCFrameworkSlice{
+		Architectures: make([]string, 0),
+	}
+	slice.Identifier, _ = properties["LibraryIdentifier"].(string)
+	slice.LibraryPath, _ = properties["LibraryPath"].(string)
+	slice.Platform, _ = properties["SupportedPlatform"].(string)
+	slice.PlatformVariant, _ = properties["SupportedPlatformVariant"].(string)
+	if architectures, ok := properties["SupportedArchitectures"].([]interface{}); ok {
+		for _, architecture := range architectures {
+			if str, ok := architecture.(string); ok {
+				slice.Architectures = append(slice.Architectures, str)
+			}
+		}
+	}
+
+	switch {
+	case strings.HasSuffix(slice.LibraryPath, FrameworkExtension):
+		slice.LibraryType = "framework"
+	case strings.HasSuffix(slice.LibraryPath, ".a"):
+		slice.LibraryType = "static_library"
+	default:
+		slice.LibraryType = "dynamic_library"
+	}
+
+	return slice
+}
@@ -1,27 +1,17 @@
 package analyzer
 
 import (
+	"bytes"
 	"fmt"
-	"os"
-	"path/filepath"
+	"io/fs"
 
 	"howett.net/plist"
 )
 
-// AnalyzeInfoPlist reads and parses the Info.plist file from the provided path
+// AnalyzeInfoPlist reads and parses the Info.plist file at the root of the bundle
 // and updates the AppBundle with the extracted information
-func AnalyzeInfoPlist(bundlePath string, bundle *AppBundle) error {
-	infoPlistPath := filepath.Join(bundlePath, "Info.plist")
-
-	f, err := os.Open(infoPlistPath)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	var data map[string]interface{}
-	decoder := plist.NewDecoder(f)
-	err = decoder.Decode(&data)
+func AnalyzeInfoPlist(fsys fs.FS, bundle *AppBundle) error {
+	data, err := readInfoPlist(fsys, "Info.plist")
 	if err != nil {
 		return err
 	}
@@ -57,3 +47,19 @@ func AnalyzeInfoPlist(bundlePath string, bundle *AppBundle) error {
 
 	return nil
 }
+
+// readInfoPlist decodes the named property list of fsys
+func readInfoPlist(fsys fs.FS, name string) (map[string]interface{}, error) {
+	content, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var data map[string]interface{}
+	decoder := plist.NewDecoder(bytes.NewReader(content))
+	if err := decoder.Decode(&data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
@@ -2,71 +2,95 @@ package analyzer
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 )
 
-func analyzeIOSBundle(bundle_path string) (*AppBundle, error) {
+func analyzeIOSBundle(bundle_path string, options Options) (*AppBundle, error) {
 	ext := strings.ToLower(filepath.Ext(bundle_path))
 
-	var app_path string
-	var tempDir string
-	defer func() {
-		if tempDir != "" {
-			os.RemoveAll(tempDir)
-		}
-	}()
+	var bundle *AppBundle
 	var err error
 	switch ext {
 	case AppExtension:
-		app_path = bundle_path
+		bundle, err = AnalyzeAppBundle(os.DirFS(bundle_path), filepath.Base(bundle_path), "", options)
 	case IpaExtension:
-		app_path, tempDir, err = analyzeIpa(bundle_path)
+		bundle, err = analyzeIpa(bundle_path, options)
 	case XcarchiveExtension:
-		app_path, err = analyzeXcarchive(bundle_path)
+		bundle, err = analyzeXcarchive(bundle_path, options)
+	case FrameworkExtension:
+		bundle, err = analyzeFramework(bundle_path, options)
+	case XcframeworkExtension:
+		bundle, err = analyzeXcframework(bundle_path, options)
 	default:
 		return nil, fmt.Errorf("unsupported file extension: %s", ext)
 	}
-
 	if err != nil {
 		return nil, err
 	}
 
-	return AnalyzeAppBundle(app_path)
+	// Link maps break the binaries down by the static libraries they were linked from
+	if err := applyLinkMaps(bundle, options.LinkMapPaths); err != nil {
+		return nil, err
+	}
+
+	return bundle, nil
 }
 
-func analyzeXcarchive(app_path string) (string, error) {
-	productsPath := filepath.Join(app_path, "Products", "Applications")
-	return findAppPath(productsPath)
+func analyzeXcarchive(archive_path string, options Options) (*AppBundle, error) {
+	productsPath := filepath.Join(archive_path, "Products", "Applications")
+	appName, err := findAppPath(os.DirFS(productsPath))
+	if err != nil {
+		return nil, err
+	}
+
+	bundle, err := AnalyzeAppBundle(os.DirFS(filepath.Join(productsPath, appName)), appName, "", options)
+	if err != nil {
+		return nil, err
+	}
+
+	// Archive metadata, other products and debug symbols
+	bundle.Xcarchive, err = analyzeXcarchiveContents(archive_path, bundle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to analyze archive: %v", err)
+	}
+
+	return bundle, nil
 }
 
-func analyzeIpa(app_path string) (string, string, error) {
-	tempDir, err := unzip(app_path)
+func analyzeIpa(ipa_path string, options Options) (*AppBundle, error) {
+	// Analyze the IPA in place
+	archive, err := openArchive(ipa_path, options.ArchiveLimits, options.Workspace)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to unzip IPA: %v", err)
+		return nil, fmt.Errorf("failed to open IPA: %w", err)
 	}
+	defer archive.Close()
 
 	// Find the .app file in Payload directory
-	payloadPath := filepath.Join(tempDir, "Payload")
-	appPath, err := findAppPath(payloadPath)
-	return appPath, tempDir, err
+	payload := archive.Sub("Payload")
+	appName, err := findAppPath(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return AnalyzeAppBundle(payload.Sub(appName), appName, ipa_path, options)
 }
 
-func findAppPath(directory string) (string, error) {
-	matches, err := filepath.Glob(filepath.Join(directory, "*.app"))
+// findAppPath returns the name of the first .app bundle at the root of fsys
+func findAppPath(fsys fs.FS) (string, error) {
+	entries, err := fs.ReadDir(fsys, ".")
 	if err != nil {
 		return "", fmt.Errorf("error searching for .app file: %v", err)
 	}
-	if len(matches) == 0 {
-		return "", fmt.Errorf("no .app file found in Payload directory")
-	}
 
-	// Get absolute path of the first match
-	absPath, err := filepath.Abs(matches[0])
-	if err != nil {
-		return "", fmt.Errorf("error getting absolute path: %v", err)
+	for _, entry := range entries {
+		if entry.IsDir() && path.Ext(entry.Name()) == AppExtension {
+			return entry.Name(), nil
+		}
 	}
 
-	return absPath, nil
+	return "", fmt.Errorf("no .app file found in Payload directory")
 }
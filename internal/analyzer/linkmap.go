@@ -0,0 +1,304 @@
+package analyzer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LinkMap attributes a slice of a binary to the object files and static libraries it was linked from,
+// as read from the link map ld writes with LD_GENERATE_MAP_FILE
+type LinkMap struct {
+	Path         string             `json:"path"`
+	Architecture string             `json:"architecture"`
+	Libraries    []LinkedLibrary    `json:"libraries"`
+	ObjectFiles  []LinkedObjectFile `json:"object_files"`
+}
+
+// LinkedLibrary is a static library, pod or target the object files of the binary come from
+type LinkedLibrary struct {
+	Name        string `json:"name"`
+	TextSize    int64  `json:"text_size"`
+	DataSize    int64  `json:"data_size"`
+	Size        int64  `json:"size"`
+	ObjectFiles int    `json:"object_files"`
+}
+
+// LinkedObjectFile is an object file linked into the binary
+type LinkedObjectFile struct {
+	Path     string `json:"path"`
+	Library  string `json:"library"`
+	TextSize int64  `json:"text_size"`
+	DataSize int64  `json:"data_size"`
+	Size     int64  `json:"size"`
+}
+
+// linkMapSection is a section listed in the link map
+type linkMapSection struct {
+	address uint64
+	size    uint64
+	segment string
+	name    string
+}
+
+// zeroFillSectionNames are the sections that occupy no space in the file
+var zeroFillSectionNames = map[string]bool{
+	"__bss":        true,
+	"__common":     true,
+	"__thread_bss": true,
+}
+
+// applyLinkMaps reads the link maps and adds them to the binaries they were written for
+func applyLinkMaps(bundle *AppBundle, linkMapPaths []string) error {
+	for _, linkMapPath := range linkMapPaths {
+		linkMap, binaryPath, sections, err := parseLinkMap(linkMapPath)
+		if err != nil {
+			return err
+		}
+
+		machO := findLinkedBinary(bundle.MachOFiles, binaryPath)
+		if machO == nil {
+			fmt.Printf("Warning: no binary of the bundle matches link map %s of %s\n", linkMapPath, binaryPath)
+			continue
+		}
+		if !slices.Contains(machO.Architecture, linkMap.Architecture) {
+			fmt.Printf("Warning: link map %s is for %s, which %s doesn't contain\n", linkMapPath, linkMap.Architecture, machO.Path)
+			continue
+		}
+		if !sectionsMatch(machO.Segments[linkMap.Architecture], sections) {
+			fmt.Printf("Warning: sections of link map %s don't match %s, it may be from another build\n", linkMapPath, machO.Path)
+		}
+
+		machO.LinkMaps = append(machO.LinkMaps, *linkMap)
+	}
+
+	return nil
+}
+
+// parseLinkMap reads a link map, it returns the path of the binary it describes and its sections
+func parseLinkMap(linkMapPath string) (*LinkMap, string, []linkMapSection, error) {
+	file, err := os.Open(linkMapPath)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to read link map: %v", err)
+	}
+	defer file.Close()
+
+	linkMap := &LinkMap{
+		Path:        linkMapPath,
+		Libraries:   make([]LinkedLibrary, 0),
+		ObjectFiles: make([]LinkedObjectFile, 0),
+	}
+	// Xcode names link maps like App-LinkMap-normal-arm64.txt
+	binaryPath, _, _ := strings.Cut(filepath.Base(linkMapPath), "-LinkMap-")
+
+	var sections []linkMapSection
+	objectFiles := make(map[int]*LinkedObjectFile)
+	var objectOrder []int
+
+	reader := bufio.NewReader(file)
+	part := ""
+	for {
+		// Lines of literal strings can be arbitrarily long
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, "", nil, fmt.Errorf("failed to read link map %s: %v", linkMapPath, err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case strings.HasPrefix(line, "# Path:"):
+			binaryPath = strings.TrimSpace(strings.TrimPrefix(line, "# Path:"))
+		case strings.HasPrefix(line, "# Arch:"):
+			linkMap.Architecture = strings.TrimSpace(strings.TrimPrefix(line, "# Arch:"))
+		case strings.HasPrefix(line, "# Object files:"):
+			part = "objects"
+		case strings.HasPrefix(line, "# Sections:"):
+			part = "sections"
+		case strings.HasPrefix(line, "# Symbols:"):
+			part = "symbols"
+		case strings.HasPrefix(line, "# Dead Stripped Symbols:"):
+			part = ""
+		case strings.HasPrefix(line, "#") || line == "":
+		case part == "objects":
+			index, objectPath, ok := parseLinkMapFileIndex(line)
+			if ok {
+				objectFiles[index] = &LinkedObjectFile{Path: objectPath, Library: linkedLibraryName(objectPath)}
+				objectOrder = append(objectOrder, index)
+			}
+		case part == "sections":
+			fields := strings.Fields(line)
+			if len(fields) < 4 {
+				continue
+			}
+			address, err1 := strconv.ParseUint(fields[0], 0, 64)
+			size, err2 := strconv.ParseUint(fields[1], 0, 64)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			sections = append(sections, linkMapSection{address: address, size: size, segment: fields[2], name: fields[3]})
+		case part == "symbols":
+			addLinkMapSymbol(line, sections, objectFiles)
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if linkMap.Architecture == "" {
+		return nil, "", nil, fmt.Errorf("failed to parse link map %s: no architecture found", linkMapPath)
+	}
+
+	libraries := make(map[string]*LinkedLibrary)
+	for _, index := range objectOrder {
+		object := objectFiles[index]
+		if object.Size == 0 {
+			continue
+		}
+		linkMap.ObjectFiles = append(linkMap.ObjectFiles, *object)
+
+		library, ok := libraries[object.Library]
+		if !ok {
+			library = &LinkedLibrary{Name: object.Library}
+			libraries[object.Library] = library
+		}
+		library.TextSize += object.TextSize
+		library.DataSize += object.DataSize
+		library.Size += object.Size
+		library.ObjectFiles++
+	}
+	for _, library := range libraries {
+		linkMap.Libraries = append(linkMap.Libraries, *library)
+	}
+
+	sort.Slice(linkMap.Libraries, func(i, j int) bool {
+		if linkMap.Libraries[i].Size != linkMap.Libraries[j].Size {
+			return linkMap.Libraries[i].Size > linkMap.Libraries[j].Size
+		}
+		return linkMap.Libraries[i].Name < linkMap.Libraries[j].Name
+	})
+	sort.SliceStable(linkMap.ObjectFiles, func(i, j int) bool {
+		return linkMap.ObjectFiles[i].Size > linkMap.ObjectFiles[j].Size
+	})
+	if len(linkMap.ObjectFiles) > maxAttributedEntries {
+		linkMap.ObjectFiles = linkMap.ObjectFiles[:maxAttributedEntries]
+	}
+
+	return linkMap, binaryPath, sections, nil
+}
+
+// addLinkMapSymbol adds a symbol line like "0x100004000	0x00000040	[  1] _main" to the object file it comes from
+func addLinkMapSymbol(line string, sections []linkMapSection, objectFiles map[int]*LinkedObjectFile) {
+	fields := strings.SplitN(line, "\t", 3)
+	if len(fields) < 3 {
+		return
+	}
+	address, err := strconv.ParseUint(strings.TrimSpace(fields[0]), 0, 64)
+	if err != nil {
+		return
+	}
+	size, err := strconv.ParseUint(strings.TrimSpace(fields[1]), 0, 64)
+	if err != nil {
+		return
+	}
+	index, _, ok := parseLinkMapFileIndex(fields[2])
+	if !ok {
+		return
+	}
+	object, ok := objectFiles[index]
+	if !ok {
+		return
+	}
+
+	// Sections are listed by increasing address
+	i := sort.Search(len(sections), func(i int) bool {
+		return sections[i].address+sections[i].size > address
+	})
+	if i == len(sections) || sections[i].address > address || zeroFillSectionNames[sections[i].name] {
+		return
+	}
+
+	switch {
+	case sections[i].segment == "__TEXT":
+		object.TextSize += int64(size)
+	case strings.HasPrefix(sections[i].segment, "__DATA"):
+		object.DataSize += int64(size)
+	}
+	object.Size += int64(size)
+}
+
+// parseLinkMapFileIndex reads the "[  1] rest" prefix referring to an object file
+func parseLinkMapFileIndex(text string) (int, string, bool) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "[") {
+		return 0, "", false
+	}
+	end := strings.IndexByte(text, ']')
+	if end < 0 {
+		return 0, "", false
+	}
+	index, err := strconv.Atoi(strings.TrimSpace(text[1:end]))
+	if err != nil {
+		return 0, "", false
+	}
+	return index, strings.TrimSpace(text[end+1:]), true
+}
+
+// linkedLibraryName returns the library an object file belongs to, the static library or framework
+// of archive members like "libPods.a(File.o)", otherwise the target it was built in by Xcode or SwiftPM
+func linkedLibraryName(objectPath string) string {
+	if archive, _, ok := strings.Cut(objectPath, "("); ok && strings.HasSuffix(objectPath, ")") {
+		if dir := path.Base(path.Dir(archive)); strings.HasSuffix(dir, FrameworkExtension) {
+			return dir
+		}
+		return path.Base(archive)
+	}
+
+	// Object files are built in <Target>.build/Objects-normal/<arch>
+	components := strings.Split(objectPath, "/")
+	for i := len(components) - 2; i >= 0; i-- {
+		if strings.HasSuffix(components[i], ".build") {
+			return strings.TrimSuffix(components[i], ".build")
+		}
+	}
+
+	if objectPath == "linker synthesized" {
+		return "(linker synthesized)"
+	}
+	return strings.TrimSuffix(path.Base(objectPath), path.Ext(objectPath))
+}
+
+// findLinkedBinary returns the binary of the bundle a link map was written for, by name
+func findLinkedBinary(machOFiles []MachOInfo, binaryPath string) *MachOInfo {
+	name := path.Base(filepath.ToSlash(binaryPath))
+	for i := range machOFiles {
+		if path.Base(machOFiles[i].Path) == name {
+			return &machOFiles[i]
+		}
+	}
+	return nil
+}
+
+// sectionsMatch reports whether the __TEXT,__text section of the link map has the size of the one of the binary
+func sectionsMatch(segments []MachOSegment, sections []linkMapSection) bool {
+	for _, section := range sections {
+		if section.segment != "__TEXT" || section.name != "__text" {
+			continue
+		}
+		for _, segment := range segments {
+			for _, machOSection := range segment.Sections {
+				if segment.Name == "__TEXT" && machOSection.Name == "__text" {
+					return machOSection.Size == int64(section.size)
+				}
+			}
+		}
+	}
+	return true
+}
@@ -1,10 +1,11 @@
 package analyzer
 
 import (
+	"debug/macho"
+	"encoding/binary"
 	"fmt"
-	"os"
-	"os/exec"
-	"path/filepath"
+	"io"
+	"io/fs"
 	"strings"
 )
 
@@ -17,116 +18,471 @@ type MachOInfo struct {
 	LinkedLibs   []string `json:"linked_libraries,omitempty"`
 	RPaths       []string `json:"rpaths,omitempty"`
 	Size         int64    `json:"size"`
+	// SliceSizes holds the size of each architecture slice of the binary
+	SliceSizes map[string]int64 `json:"slice_sizes,omitempty"`
+	// UUIDs holds the LC_UUID of each architecture slice, which its dSYM must match
+	UUIDs map[string]string `json:"uuids,omitempty"`
+	// Segments holds the segments of each architecture slice with the file bytes they occupy
+	Segments map[string][]MachOSegment `json:"segments,omitempty"`
+	// LinkMaps attribute the slices to the object files and libraries they were linked from, when given
+	LinkMaps []LinkMap `json:"link_maps,omitempty"`
+
+	// attribution breaks the preferred slice down by symbols
+	attribution *CodeAttribution
 }
 
-// FindAndAnalyzeMachO searches for and analyzes Mach-O binaries in the bundle
-func FindAndAnalyzeMachO(bundlePath string, bundle *AppBundle) error {
-	// Check if otool exists
-	if _, err := exec.LookPath("otool"); err != nil {
-		return fmt.Errorf("otool not found: this tool requires macOS")
-	}
+// MachOSegment is a segment of a Mach-O slice, like __TEXT or __LINKEDIT
+type MachOSegment struct {
+	Name     string         `json:"name"`
+	Size     int64          `json:"size"`
+	Sections []MachOSection `json:"sections,omitempty"`
+}
+
+// MachOSection is a section of a segment, like __text or __cstring, the data
+// of __LINKEDIT is broken down by the load commands referencing it instead
+type MachOSection struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// Section types that occupy no space in the file
+const (
+	sectionTypeMask      = 0xff
+	sZeroFill            = 0x1
+	sGBZeroFill          = 0xc
+	sThreadLocalZeroFill = 0x12
+)
+
+// linkeditDataNames maps the linkedit_data_command identifiers to the data they point to
+var linkeditDataNames = map[uint32]string{
+	0x1d:             "code signature",
+	0x1e:             "segment split info",
+	0x26:             "function starts",
+	0x29:             "data in code",
+	0x2b:             "dylib code signing DRs",
+	0x2e:             "linker optimization hints",
+	0x33 | lcReqDyld: "exports trie",
+	0x34 | lcReqDyld: "chained fixups",
+}
+
+// dyldInfoNames are the offset and size pairs of LC_DYLD_INFO, in order
+var dyldInfoNames = []string{"rebase info", "binding info", "weak binding info", "lazy binding info", "export info"}
+
+// Load command identifiers that are not exported by debug/macho
+const (
+	lcReqDyld            = 0x80000000
+	lcLoadWeakDylib      = 0x18 | lcReqDyld
+	lcRPath              = 0x1c | lcReqDyld
+	lcReexportDylib      = 0x1f | lcReqDyld
+	lcLazyLoadDylib      = 0x20
+	lcLoadUpwardDylib    = 0x23 | lcReqDyld
+	lcVersionMinMacOSX   = 0x24
+	lcVersionMinIPhoneOS = 0x25
+	lcVersionMinTvOS     = 0x2f
+	lcVersionMinWatchOS  = 0x30
+	lcBuildVersion       = 0x32
+	lcUUID               = 0x1b
+)
 
-	err := filepath.Walk(bundlePath, func(path string, info os.FileInfo, err error) error {
+// loadCommandNames maps load command identifiers to their LC_* names
+var loadCommandNames = map[uint32]string{
+	0x1:                  "LC_SEGMENT",
+	0x2:                  "LC_SYMTAB",
+	0x5:                  "LC_UNIXTHREAD",
+	0xb:                  "LC_DYSYMTAB",
+	0xc:                  "LC_LOAD_DYLIB",
+	0xd:                  "LC_ID_DYLIB",
+	0xe:                  "LC_LOAD_DYLINKER",
+	0x19:                 "LC_SEGMENT_64",
+	lcUUID:               "LC_UUID",
+	0x1d:                 "LC_CODE_SIGNATURE",
+	0x1e:                 "LC_SEGMENT_SPLIT_INFO",
+	0x21:                 "LC_ENCRYPTION_INFO",
+	0x22:                 "LC_DYLD_INFO",
+	0x22 | lcReqDyld:     "LC_DYLD_INFO_ONLY",
+	0x26:                 "LC_FUNCTION_STARTS",
+	0x29:                 "LC_DATA_IN_CODE",
+	0x2a:                 "LC_SOURCE_VERSION",
+	0x2b:                 "LC_DYLIB_CODE_SIGN_DRS",
+	0x2c:                 "LC_ENCRYPTION_INFO_64",
+	0x2d:                 "LC_LINKER_OPTION",
+	0x2e:                 "LC_LINKER_OPTIMIZATION_HINT",
+	0x28 | lcReqDyld:     "LC_MAIN",
+	0x33 | lcReqDyld:     "LC_DYLD_EXPORTS_TRIE",
+	0x34 | lcReqDyld:     "LC_DYLD_CHAINED_FIXUPS",
+	lcLoadWeakDylib:      "LC_LOAD_WEAK_DYLIB",
+	lcRPath:              "LC_RPATH",
+	lcReexportDylib:      "LC_REEXPORT_DYLIB",
+	lcLazyLoadDylib:      "LC_LAZY_LOAD_DYLIB",
+	lcLoadUpwardDylib:    "LC_LOAD_UPWARD_DYLIB",
+	lcVersionMinMacOSX:   "LC_VERSION_MIN_MACOSX",
+	lcVersionMinIPhoneOS: "LC_VERSION_MIN_IPHONEOS",
+	lcVersionMinTvOS:     "LC_VERSION_MIN_TVOS",
+	lcVersionMinWatchOS:  "LC_VERSION_MIN_WATCHOS",
+	lcBuildVersion:       "LC_BUILD_VERSION",
+}
+
+// FindAndAnalyzeMachO searches for and analyzes Mach-O binaries in the bundle
+func FindAndAnalyzeMachO(fsys fs.FS, bundle *AppBundle) error {
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
-		// Skip directories and non-regular files
-		if info.IsDir() || !info.Mode().IsRegular() {
-			return nil
+		// dSYMs hold the DWARF of the binaries, not shipped code
+		if entry.IsDir() && strings.HasSuffix(name, ".dSYM") {
+			return fs.SkipDir
 		}
 
-		// Run file command to check if it's a Mach-O binary
-		cmd := exec.Command("file", path)
-		output, err := cmd.Output()
-		if err != nil {
-			return nil // Skip if file command fails
+		// Skip directories and non-regular files
+		if entry.IsDir() || !entry.Type().IsRegular() {
+			return nil
 		}
 
-		// Check if the file is a Mach-O binary
-		if !strings.Contains(string(output), "Mach-O") {
+		// Check the magic number to see if it's a Mach-O binary, fat static libraries hold ar archives instead
+		if !isMachOFile(fsys, name) || isStaticArchive(fsys, name) {
 			return nil
 		}
 
 		// Analyze the Mach-O binary
-		machO, err := analyzeMachO(path)
+		machO, err := analyzeMachO(fsys, name)
 		if err != nil {
-			return fmt.Errorf("failed to analyze Mach-O binary %s: %v", path, err)
+			return fmt.Errorf("failed to analyze Mach-O binary %s: %v", name, err)
 		}
 
 		// Add to bundle's Mach-O information
 		bundle.MachOFiles = append(bundle.MachOFiles, *machO)
+		if machO.attribution != nil && machO.attribution.AttributedSize > 0 {
+			bundle.CodeAttribution = append(bundle.CodeAttribution, *machO.attribution)
+		}
 		return nil
 	})
 
 	return err
 }
 
-// analyzeMachO analyzes a single Mach-O binary using otool
-func analyzeMachO(path string) (*MachOInfo, error) {
+// isMachOFile reports whether the file starts with a thin or fat Mach-O header
+func isMachOFile(fsys fs.FS, name string) bool {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	var header [8]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil {
+		return false
+	}
+
+	switch binary.BigEndian.Uint32(header[:4]) {
+	case macho.Magic32, macho.Magic64:
+		return true
+	case macho.MagicFat:
+		// Java class files share the fat magic, their major version is
+		// far larger than any realistic number of architectures
+		return binary.BigEndian.Uint32(header[4:]) < 0x20
+	}
+
+	switch binary.LittleEndian.Uint32(header[:4]) {
+	case macho.Magic32, macho.Magic64:
+		return true
+	}
+
+	return false
+}
+
+// isStaticArchive reports whether the file is an ar archive of object files, or a fat file of them
+func isStaticArchive(fsys fs.FS, name string) bool {
+	r, err := openReaderAt(fsys, name)
+	if err != nil {
+		return false
+	}
+	defer r.Close()
+
+	const arMagic = "!<arch>\n"
+	header := make([]byte, 20)
+	if n, _ := r.ReadAt(header, 0); n < len(arMagic) {
+		return false
+	}
+	if string(header[:len(arMagic)]) == arMagic {
+		return true
+	}
+	if binary.BigEndian.Uint32(header) != macho.MagicFat {
+		return false
+	}
+
+	// The first fat_arch follows the header, its offset points to the slice
+	magic := make([]byte, len(arMagic))
+	if _, err := r.ReadAt(magic, int64(binary.BigEndian.Uint32(header[16:]))); err != nil {
+		return false
+	}
+	return string(magic) == arMagic
+}
+
+// analyzeMachO analyzes a single Mach-O binary, handling both thin and fat files
+func analyzeMachO(fsys fs.FS, name string) (*MachOInfo, error) {
 	info := &MachOInfo{
-		Path: path,
+		Path:       name,
+		SliceSizes: make(map[string]int64),
+		UUIDs:      make(map[string]string),
+		Segments:   make(map[string][]MachOSegment),
 	}
 
 	// Get file size
-	fileInfo, err := os.Stat(path)
+	fileInfo, err := fs.Stat(fsys, name)
 	if err != nil {
 		return nil, err
 	}
 	info.Size = fileInfo.Size()
 
-	// Get architectures
-	cmd := exec.Command("lipo", "-info", path)
-	output, err := cmd.Output()
+	r, err := openReaderAt(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	// Collect the slices of the binary, a thin binary has a single slice
+	var slices []*macho.File
+	fat, err := macho.NewFatFile(r)
 	if err == nil {
-		// Parse architectures from lipo output
-		parts := strings.Split(string(output), ":")
-		if len(parts) > 1 {
-			archs := strings.Split(strings.TrimSpace(parts[len(parts)-1]), " ")
-			info.Architecture = archs
+		for _, arch := range fat.Arches {
+			slices = append(slices, arch.File)
+			info.SliceSizes[cpuName(arch.Cpu, arch.SubCpu)] = int64(arch.Size)
 		}
+	} else if err == macho.ErrNotFat {
+		f, err := macho.NewFile(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse Mach-O: %v", err)
+		}
+		slices = append(slices, f)
+		info.SliceSizes[cpuName(f.Cpu, f.SubCpu)] = info.Size
+	} else {
+		return nil, fmt.Errorf("failed to parse fat Mach-O: %v", err)
 	}
 
-	// Get load commands and linked libraries
-	cmd = exec.Command("otool", "-l", "-L", path)
-	output, err = cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("otool failed: %v", err)
+	var architectures []string
+	for _, f := range slices {
+		architectures = append(architectures, cpuName(f.Cpu, f.SubCpu))
 	}
+	preferred := preferredArchitecture(architectures)
 
-	// Parse otool output
-	lines := strings.Split(string(output), "\n")
-	for i, line := range lines {
-		line = strings.TrimSpace(line)
+	seenCommands := make(map[string]bool)
+	seenLibs := make(map[string]bool)
+	seenRPaths := make(map[string]bool)
 
-		// Extract minimum OS version
-		if strings.Contains(line, "LC_VERSION_MIN_IPHONEOS") && i+2 < len(lines) {
-			versionLine := strings.TrimSpace(lines[i+2])
-			if strings.HasPrefix(versionLine, "version") {
-				parts := strings.Fields(versionLine)
-				if len(parts) > 1 {
-					info.MinOSVersion = parts[1]
+	for _, f := range slices {
+		info.Architecture = append(info.Architecture, cpuName(f.Cpu, f.SubCpu))
+		info.Segments[cpuName(f.Cpu, f.SubCpu)] = machOSegments(f)
+		if cpuName(f.Cpu, f.SubCpu) == preferred && info.attribution == nil {
+			info.attribution = attributeCode(f, name, preferred)
+		}
+
+		for _, load := range f.Loads {
+			raw := load.Raw()
+			if len(raw) < 8 {
+				continue
+			}
+			cmd := f.ByteOrder.Uint32(raw[0:4])
+
+			name, ok := loadCommandNames[cmd]
+			if !ok {
+				name = fmt.Sprintf("LC_0x%x", cmd)
+			}
+			if !seenCommands[name] {
+				seenCommands[name] = true
+				info.LoadCommands = append(info.LoadCommands, name)
+			}
+
+			switch cmd {
+			case uint32(macho.LoadCmdDylib), lcLoadWeakDylib, lcReexportDylib, lcLazyLoadDylib, lcLoadUpwardDylib:
+				// Extract linked libraries
+				lib := loadCommandString(raw, f.ByteOrder)
+				if lib != "" && !seenLibs[lib] {
+					seenLibs[lib] = true
+					info.LinkedLibs = append(info.LinkedLibs, lib)
+				}
+			case lcRPath:
+				// Extract RPaths
+				rpath := loadCommandString(raw, f.ByteOrder)
+				if rpath != "" && !seenRPaths[rpath] {
+					seenRPaths[rpath] = true
+					info.RPaths = append(info.RPaths, rpath)
+				}
+			case lcVersionMinMacOSX, lcVersionMinIPhoneOS, lcVersionMinTvOS, lcVersionMinWatchOS:
+				// Extract minimum OS version
+				if info.MinOSVersion == "" && len(raw) >= 12 {
+					info.MinOSVersion = formatMachOVersion(f.ByteOrder.Uint32(raw[8:12]))
+				}
+			case lcBuildVersion:
+				if info.MinOSVersion == "" && len(raw) >= 16 {
+					info.MinOSVersion = formatMachOVersion(f.ByteOrder.Uint32(raw[12:16]))
+				}
+			case lcUUID:
+				if len(raw) >= 24 {
+					info.UUIDs[cpuName(f.Cpu, f.SubCpu)] = formatUUID(raw[8:24])
 				}
 			}
 		}
+	}
 
-		// Extract linked libraries
-		if strings.HasPrefix(line, "/") && strings.Contains(line, ".dylib") {
-			lib := strings.Fields(line)[0]
-			info.LinkedLibs = append(info.LinkedLibs, lib)
+	return info, nil
+}
+
+// machOSegments returns the segments of the slice that occupy space in the file, with their sections
+func machOSegments(f *macho.File) []MachOSegment {
+	var segments []MachOSegment
+	for _, load := range f.Loads {
+		segment, ok := load.(*macho.Segment)
+		if !ok || segment.Filesz == 0 {
+			continue
 		}
 
-		// Extract RPaths
-		if strings.Contains(line, "LC_RPATH") && i+2 < len(lines) {
-			pathLine := strings.TrimSpace(lines[i+2])
-			if strings.HasPrefix(pathLine, "path") {
-				parts := strings.Fields(pathLine)
-				if len(parts) > 1 {
-					info.RPaths = append(info.RPaths, parts[1])
-				}
+		machOSegment := MachOSegment{
+			Name:     segment.Name,
+			Size:     int64(segment.Filesz),
+			Sections: make([]MachOSection, 0),
+		}
+		for _, section := range f.Sections {
+			if section.Seg != segment.Name {
+				continue
+			}
+			switch section.Flags & sectionTypeMask {
+			case sZeroFill, sGBZeroFill, sThreadLocalZeroFill:
+				continue
 			}
+			machOSegment.Sections = append(machOSegment.Sections, MachOSection{
+				Name: section.Name,
+				Size: int64(section.Size),
+			})
+		}
+		if segment.Name == "__LINKEDIT" {
+			machOSegment.Sections = linkeditSections(f)
 		}
+
+		segments = append(segments, machOSegment)
 	}
+	return segments
+}
 
-	return info, nil
+// linkeditSections breaks __LINKEDIT down by the symbol tables and the data of the load commands
+func linkeditSections(f *macho.File) []MachOSection {
+	sections := make([]MachOSection, 0)
+	add := func(name string, size uint64) {
+		if size > 0 {
+			sections = append(sections, MachOSection{Name: name, Size: int64(size)})
+		}
+	}
+
+	symbolSize := uint64(12)
+	if f.Magic == macho.Magic64 {
+		symbolSize = 16
+	}
+
+	// debug/macho doesn't fill the symtab command, every command is read from its raw bytes
+	for _, load := range f.Loads {
+		raw := load.Raw()
+		if len(raw) < 16 {
+			continue
+		}
+		cmd := f.ByteOrder.Uint32(raw[0:4])
+		switch {
+		case cmd == uint32(macho.LoadCmdSymtab) && len(raw) >= 24:
+			add("symbol table", uint64(f.ByteOrder.Uint32(raw[12:16]))*symbolSize)
+			add("string table", uint64(f.ByteOrder.Uint32(raw[20:24])))
+		case cmd == uint32(macho.LoadCmdDysymtab) && len(raw) >= 64:
+			add("indirect symbols", uint64(f.ByteOrder.Uint32(raw[60:64]))*4)
+		case linkeditDataNames[cmd] != "":
+			add(linkeditDataNames[cmd], uint64(f.ByteOrder.Uint32(raw[12:16])))
+		case (cmd == 0x22 || cmd == 0x22|lcReqDyld) && len(raw) >= 48:
+			for i, name := range dyldInfoNames {
+				add(name, uint64(f.ByteOrder.Uint32(raw[12+i*8:16+i*8])))
+			}
+		}
+	}
+	return sections
+}
+
+// loadCommandString reads the lc_str stored in dylib and rpath load commands
+func loadCommandString(raw []byte, byteOrder binary.ByteOrder) string {
+	if len(raw) < 12 {
+		return ""
+	}
+	offset := byteOrder.Uint32(raw[8:12])
+	if offset >= uint32(len(raw)) {
+		return ""
+	}
+	str := raw[offset:]
+	for i, b := range str {
+		if b == 0 {
+			return string(str[:i])
+		}
+	}
+	return string(str)
+}
+
+// formatUUID formats the 16 bytes of an LC_UUID the way dwarfdump prints them
+func formatUUID(b []byte) string {
+	return strings.ToUpper(fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]))
+}
+
+// formatMachOVersion converts a packed xxxx.yy.zz version number to a string
+func formatMachOVersion(version uint32) string {
+	major := version >> 16
+	minor := (version >> 8) & 0xff
+	patch := version & 0xff
+	if patch == 0 {
+		return fmt.Sprintf("%d.%d", major, minor)
+	}
+	return fmt.Sprintf("%d.%d.%d", major, minor, patch)
+}
+
+// cpuName returns the architecture name for the given CPU type, as printed by lipo
+func cpuName(cpu macho.Cpu, subCpu uint32) string {
+	const (
+		cpuArm64_32      = 0x0200000c
+		cpuSubtypeMask   = 0x00ffffff
+		cpuSubArm64E     = 2
+		cpuSubArmV7      = 9
+		cpuSubArmV7S     = 11
+		cpuSubArmV7K     = 12
+		cpuSubX86_64H    = 8
+		cpuSubArmV6      = 6
+		cpuSubArmV7Fused = 10
+	)
+
+	sub := subCpu & cpuSubtypeMask
+	switch cpu {
+	case macho.CpuArm64:
+		if sub == cpuSubArm64E {
+			return "arm64e"
+		}
+		return "arm64"
+	case cpuArm64_32:
+		return "arm64_32"
+	case macho.CpuArm:
+		switch sub {
+		case cpuSubArmV6:
+			return "armv6"
+		case cpuSubArmV7, cpuSubArmV7Fused:
+			return "armv7"
+		case cpuSubArmV7S:
+			return "armv7s"
+		case cpuSubArmV7K:
+			return "armv7k"
+		}
+		return "arm"
+	case macho.CpuAmd64:
+		if sub == cpuSubX86_64H {
+			return "x86_64h"
+		}
+		return "x86_64"
+	case macho.Cpu386:
+		return "i386"
+	case macho.CpuPpc:
+		return "ppc"
+	case macho.CpuPpc64:
+		return "ppc64"
+	}
+
+	return fmt.Sprintf("cpu_%d", uint32(cpu))
 }
@@ -0,0 +1,63 @@
+package analyzer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// proguardMapping maps the class names R8 and ProGuard obfuscated back to their original names
+type proguardMapping struct {
+	classes map[string]string
+}
+
+// loadProguardMapping reads the classes of an R8 or ProGuard mapping.txt, lines like
+// "com.example.Foo -> a.b.c:" followed by the indented members of the class, which are skipped
+func loadProguardMapping(mappingPath string) (*proguardMapping, error) {
+	file, err := os.Open(mappingPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mapping: %v", err)
+	}
+	defer file.Close()
+
+	mapping := &proguardMapping{classes: make(map[string]string)}
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to read mapping %s: %v", mappingPath, err)
+		}
+
+		// Members are indented and comments hold R8 metadata
+		line = strings.TrimRight(line, "\r\n")
+		if line != "" && line[0] != ' ' && line[0] != '\t' && line[0] != '#' {
+			original, obfuscated, ok := strings.Cut(strings.TrimSuffix(line, ":"), " -> ")
+			if ok {
+				mapping.classes[strings.TrimSpace(obfuscated)] = strings.TrimSpace(original)
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if len(mapping.classes) == 0 {
+		return nil, fmt.Errorf("failed to parse mapping %s: no class found", mappingPath)
+	}
+
+	return mapping, nil
+}
+
+// deobfuscateClass returns the original name of a class like "a.b.c", the name is kept when it wasn't renamed
+func (m *proguardMapping) deobfuscateClass(name string) string {
+	if m == nil {
+		return name
+	}
+	if original, ok := m.classes[name]; ok {
+		return original
+	}
+	return name
+}
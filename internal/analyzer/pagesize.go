@@ -0,0 +1,78 @@
+package analyzer
+
+import (
+	"archive/zip"
+	"debug/elf"
+	"fmt"
+	"path"
+)
+
+// pageSize16KB is the page size of the Android 15 devices the native libraries must support
+const pageSize16KB = 16384
+
+// loadAlignment returns the smallest alignment of the PT_LOAD segments of the library
+func loadAlignment(f *elf.File) int64 {
+	var alignment int64
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_LOAD {
+			continue
+		}
+		if alignment == 0 || int64(prog.Align) < alignment {
+			alignment = int64(prog.Align)
+		}
+	}
+	return alignment
+}
+
+// setZipPlacement records how the library is stored in the archive and the alignment of its data
+func setZipPlacement(library *NativeLibrary, archive *archiveFS, name string) {
+	entry, ok := archive.archive.entries[path.Join(archive.prefix, name)]
+	if !ok {
+		return
+	}
+
+	if entry.Method != zip.Store {
+		library.Compression = "deflated"
+		return
+	}
+	library.Compression = "stored"
+
+	offset, err := entry.DataOffset()
+	if err != nil {
+		return
+	}
+	library.ZipOffset = offset
+	library.ZipAlignment = 64 * 1024
+	if offset != 0 && offset&-offset < library.ZipAlignment {
+		library.ZipAlignment = offset & -offset
+	}
+}
+
+// checkPageSizeCompliance lists why each 64-bit library can't be loaded on devices with 16 KB pages,
+// the zip alignment only matters when the libraries aren't extracted at install time
+func checkPageSizeCompliance(libraries []NativeLibrary, extractNativeLibs bool) {
+	for i := range libraries {
+		library := &libraries[i]
+		library.PageSizeIssues = nil
+		if !library.is64Bit {
+			continue
+		}
+
+		if library.LoadAlignment < pageSize16KB {
+			library.PageSizeIssues = append(library.PageSizeIssues,
+				fmt.Sprintf("LOAD segments are aligned to %s instead of 16 KB", formatAlignment(library.LoadAlignment)))
+		}
+		if !extractNativeLibs && library.Compression == "stored" && library.ZipAlignment < pageSize16KB {
+			library.PageSizeIssues = append(library.PageSizeIssues,
+				fmt.Sprintf("stored at a zip offset aligned to %s instead of 16 KB", formatAlignment(library.ZipAlignment)))
+		}
+	}
+}
+
+// formatAlignment formats an alignment like "4 KB", or in bytes when smaller than a kilobyte
+func formatAlignment(alignment int64) string {
+	if alignment >= 1024 && alignment%1024 == 0 {
+		return fmt.Sprintf("%d KB", alignment/1024)
+	}
+	return fmt.Sprintf("%d bytes", alignment)
+}
@@ -0,0 +1,205 @@
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	localeScriptSubtag = regexp.MustCompile(`^[A-Za-z]{4}$`)
+	localeRegionSubtag = regexp.MustCompile(`^([A-Za-z]{2}|[0-9]{3})$`)
+)
+
+// analyzeProtoResourceTable parses the resources.pb of an app bundle module, files is the analyzed tree of the bundle,
+// it returns nil when the module has no resource table
+func analyzeProtoResourceTable(fsys fs.FS, files *FileInfo, module string) (*ResourceTable, error) {
+	tablePath := path.Join(module, "resources.pb")
+	data, err := fs.ReadFile(fsys, tablePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", tablePath, err)
+	}
+
+	table, err := parseProtoResourceTable(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", tablePath, err)
+	}
+	table.Path = tablePath
+	resolveResourceFiles(table, files, module)
+
+	return table, nil
+}
+
+// parseProtoResourceTable reads the packages, types, entries and configurations of an aapt2 ResourceTable protobuf,
+// the values of a type and configuration are summed like the type chunks of resources.arsc
+func parseProtoResourceTable(data []byte) (*ResourceTable, error) {
+	fields, err := parseProto(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse resource table: %v", err)
+	}
+
+	table := &ResourceTable{
+		Size:     int64(len(data)),
+		Packages: make([]string, 0),
+	}
+
+	for _, field := range fields {
+		// ResourceTable.package
+		if field.Number != 2 || field.WireType != protoBytes {
+			continue
+		}
+		pkg, err := parseProto(field.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse package: %v", err)
+		}
+		table.Packages = append(table.Packages, protoString(pkg, 2))
+
+		for _, typeField := range pkg {
+			if typeField.Number != 3 || typeField.WireType != protoBytes {
+				continue
+			}
+			if err := parseProtoResourceType(typeField.Bytes, table); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	table.summarize()
+
+	return table, nil
+}
+
+// parseProtoResourceType reads the entries of a Type, the size of its values is attributed to their configuration
+// and the rest of the message to the type itself
+func parseProtoResourceType(data []byte, table *ResourceTable) error {
+	resourceType, err := parseProto(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse resource type: %v", err)
+	}
+	typeName := protoString(resourceType, 2)
+
+	spec := resourceChunk{typeName: typeName, size: int64(len(data)), spec: true}
+	var chunks []resourceChunk
+	chunkIndex := make(map[string]int)
+	for _, entryField := range resourceType {
+		if entryField.Number != 3 || entryField.WireType != protoBytes {
+			continue
+		}
+		entry, err := parseProto(entryField.Bytes)
+		if err != nil {
+			return fmt.Errorf("failed to parse resource entry: %v", err)
+		}
+		name := typeName + "/" + protoString(entry, 2)
+
+		for _, configValueField := range entry {
+			if configValueField.Number != 6 || configValueField.WireType != protoBytes {
+				continue
+			}
+			configValue, err := parseProto(configValueField.Bytes)
+			if err != nil {
+				return fmt.Errorf("failed to parse value of %s: %v", name, err)
+			}
+
+			value := parseProtoResourceValue(protoMessage(configValue, 2))
+			value.name = name
+			value.config = parseProtoResourceConfig(protoMessage(configValue, 1))
+			value.size = int64(len(configValueField.Bytes))
+			table.values = append(table.values, value)
+
+			i, ok := chunkIndex[value.config.qualifiers]
+			if !ok {
+				chunks = append(chunks, resourceChunk{typeName: typeName, config: value.config})
+				i = len(chunks) - 1
+				chunkIndex[value.config.qualifiers] = i
+			}
+			chunks[i].size += value.size
+			spec.size -= value.size
+		}
+	}
+
+	table.chunks = append(table.chunks, spec)
+	table.chunks = append(table.chunks, chunks...)
+	return nil
+}
+
+// parseProtoResourceValue returns the key of a Value, without its source and comment,
+// and the path of the res/ file of file references
+func parseProtoResourceValue(value []protoField) resourceValue {
+	var parsed resourceValue
+	for _, field := range value {
+		switch {
+		case field.Number == 4 && field.WireType == protoBytes:
+			// Item, FileReference.path of file items
+			parsed.key = "item:" + string(field.Bytes)
+			if item, err := parseProto(field.Bytes); err == nil {
+				if file := protoMessage(item, 5); file != nil {
+					parsed.file = protoString(file, 1)
+				}
+			}
+		case field.Number == 5 && field.WireType == protoBytes:
+			// CompoundValue, like a style, plural or array
+			parsed.key = "compound:" + string(field.Bytes)
+		}
+	}
+	return parsed
+}
+
+// parseProtoResourceConfig decodes a Configuration message, its enums are mapped to the ResTable_config values
+func parseProtoResourceConfig(config []protoField) resourceConfig {
+	varint := func(number int) int {
+		for _, field := range config {
+			if field.Number == number && field.WireType == protoVarint {
+				return int(field.Varint)
+			}
+		}
+		return 0
+	}
+	mapped := func(number int, values map[int]int) int {
+		return values[varint(number)]
+	}
+
+	fields := resourceConfigFields{
+		mcc:             varint(1),
+		mnc:             varint(2),
+		layoutDirection: mapped(4, map[int]int{1: 0x40, 2: 0x80}),
+		widthDp:         varint(7),
+		heightDp:        varint(8),
+		smallestWidthDp: varint(9),
+		screenSize:      varint(10),
+		screenLong:      mapped(11, map[int]int{1: 0x20, 2: 0x10}),
+		screenRound:     mapped(12, map[int]int{1: 2, 2: 1}),
+		orientation:     varint(15),
+		uiModeType:      varint(16),
+		uiModeNight:     mapped(17, map[int]int{1: 0x20, 2: 0x10}),
+		density:         varint(18),
+		touchscreen:     varint(19),
+		keysHidden:      varint(20),
+		keyboard:        varint(21),
+		navHidden:       mapped(22, map[int]int{1: 0x04, 2: 0x08}),
+		navigation:      varint(23),
+		sdkVersion:      varint(24),
+	}
+
+	// BCP 47 tags like "fr-CA", "sr-Latn" or "es-419"
+	if locale := protoString(config, 3); locale != "" {
+		subtags := strings.Split(locale, "-")
+		fields.language = strings.ToLower(subtags[0])
+		for _, subtag := range subtags[1:] {
+			switch {
+			case fields.script == "" && fields.region == "" && localeScriptSubtag.MatchString(subtag):
+				fields.script = strings.ToUpper(subtag[:1]) + strings.ToLower(subtag[1:])
+			case fields.region == "" && localeRegionSubtag.MatchString(subtag):
+				fields.region = strings.ToUpper(subtag)
+			default:
+				fields.variant = subtag
+			}
+		}
+	}
+
+	return newResourceConfig(fields)
+}
@@ -0,0 +1,254 @@
+package analyzer
+
+import (
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Protobuf wire types
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+// protoField is a single decoded field of a protobuf message
+type protoField struct {
+	Number   int
+	WireType int
+	Varint   uint64
+	Bytes    []byte
+}
+
+// parseProto decodes the top level fields of a protobuf message
+func parseProto(data []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid field key")
+		}
+		data = data[n:]
+
+		field := protoField{Number: int(key >> 3), WireType: int(key & 7)}
+		switch field.WireType {
+		case protoVarint:
+			value, n := binary.Uvarint(data)
+			if n <= 0 {
+				return nil, fmt.Errorf("invalid varint in field %d", field.Number)
+			}
+			field.Varint = value
+			data = data[n:]
+		case protoFixed64:
+			if len(data) < 8 {
+				return nil, fmt.Errorf("truncated field %d", field.Number)
+			}
+			field.Varint = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case protoFixed32:
+			if len(data) < 4 {
+				return nil, fmt.Errorf("truncated field %d", field.Number)
+			}
+			field.Varint = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		case protoBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return nil, fmt.Errorf("truncated field %d", field.Number)
+			}
+			field.Bytes = data[n : uint64(n)+length]
+			data = data[uint64(n)+length:]
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d", field.WireType)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// protoString returns the first string value of the given field number
+func protoString(fields []protoField, number int) string {
+	for _, field := range fields {
+		if field.Number == number && field.WireType == protoBytes {
+			return string(field.Bytes)
+		}
+	}
+	return ""
+}
+
+// protoMessage decodes the first embedded message of the given field number
+func protoMessage(fields []protoField, number int) []protoField {
+	for _, field := range fields {
+		if field.Number == number && field.WireType == protoBytes {
+			message, err := parseProto(field.Bytes)
+			if err == nil {
+				return message
+			}
+		}
+	}
+	return nil
+}
+
+// decodeProtoXML converts an aapt2 XmlNode protobuf, as stored in app bundles, to textual XML
+func decodeProtoXML(data []byte) ([]byte, error) {
+	node, err := parseProto(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse XML node: %v", err)
+	}
+
+	var out strings.Builder
+	out.WriteString(xml.Header)
+	if err := writeProtoXMLNode(&out, node, make(map[string]string), 0); err != nil {
+		return nil, err
+	}
+	return []byte(out.String()), nil
+}
+
+// writeProtoXMLNode writes an XmlNode, which is either an element or a text node
+func writeProtoXMLNode(out *strings.Builder, node []protoField, namespaces map[string]string, depth int) error {
+	if depth > 256 {
+		return fmt.Errorf("XML nesting too deep")
+	}
+
+	for _, field := range node {
+		switch field.Number {
+		case 1: // element
+			element, err := parseProto(field.Bytes)
+			if err != nil {
+				return fmt.Errorf("failed to parse XML element: %v", err)
+			}
+			if err := writeProtoXMLElement(out, element, namespaces, depth); err != nil {
+				return err
+			}
+		case 2: // text
+			out.WriteString(escapeXML(string(field.Bytes)))
+		}
+	}
+	return nil
+}
+
+// writeProtoXMLElement writes an XmlElement with its attributes and children
+func writeProtoXMLElement(out *strings.Builder, element []protoField, namespaces map[string]string, depth int) error {
+	name := protoString(element, 3)
+	if prefix := namespaces[protoString(element, 2)]; prefix != "" {
+		name = prefix + ":" + name
+	}
+
+	// Namespace declarations are in scope for this element and its children
+	scope := namespaces
+	var xmlns []string
+	for _, field := range element {
+		if field.Number != 1 {
+			continue
+		}
+		declaration, err := parseProto(field.Bytes)
+		if err != nil {
+			return fmt.Errorf("failed to parse namespace: %v", err)
+		}
+		if len(xmlns) == 0 {
+			scope = make(map[string]string, len(namespaces)+1)
+			for uri, prefix := range namespaces {
+				scope[uri] = prefix
+			}
+		}
+		prefix, uri := protoString(declaration, 1), protoString(declaration, 2)
+		scope[uri] = prefix
+		xmlns = append(xmlns, fmt.Sprintf(" xmlns:%s=\"%s\"", prefix, escapeXML(uri)))
+	}
+	if prefix := scope[protoString(element, 2)]; prefix != "" && !strings.Contains(name, ":") {
+		name = prefix + ":" + name
+	}
+
+	out.WriteString("<" + name)
+	for _, declaration := range xmlns {
+		out.WriteString(declaration)
+	}
+
+	for _, field := range element {
+		if field.Number != 4 {
+			continue
+		}
+		attribute, err := parseProto(field.Bytes)
+		if err != nil {
+			return fmt.Errorf("failed to parse attribute: %v", err)
+		}
+		attrName := protoString(attribute, 2)
+		if attrName == "" {
+			continue
+		}
+		if prefix := scope[protoString(attribute, 1)]; prefix != "" {
+			attrName = prefix + ":" + attrName
+		}
+		out.WriteString(fmt.Sprintf(" %s=\"%s\"", attrName, escapeXML(protoAttributeValue(attribute))))
+	}
+	out.WriteString(">")
+
+	for _, field := range element {
+		if field.Number != 5 {
+			continue
+		}
+		child, err := parseProto(field.Bytes)
+		if err != nil {
+			return fmt.Errorf("failed to parse child node: %v", err)
+		}
+		if err := writeProtoXMLNode(out, child, scope, depth+1); err != nil {
+			return err
+		}
+	}
+
+	out.WriteString("</" + name + ">")
+	return nil
+}
+
+// protoAttributeValue returns the source value of an XmlAttribute, falling back to its compiled item
+func protoAttributeValue(attribute []protoField) string {
+	if value := protoString(attribute, 3); value != "" {
+		return value
+	}
+
+	item := protoMessage(attribute, 6)
+	if item == nil {
+		return ""
+	}
+
+	if ref := protoMessage(item, 1); ref != nil {
+		if name := protoString(ref, 3); name != "" {
+			return "@" + name
+		}
+		for _, field := range ref {
+			if field.Number == 2 {
+				return fmt.Sprintf("@0x%08x", field.Varint)
+			}
+		}
+	}
+	if str := protoMessage(item, 2); str != nil {
+		return protoString(str, 1)
+	}
+	if str := protoMessage(item, 3); str != nil {
+		return protoString(str, 1)
+	}
+
+	for _, field := range protoMessage(item, 7) {
+		switch field.Number {
+		case 3: // float_value
+			return fmt.Sprintf("%g", math.Float32frombits(uint32(field.Varint)))
+		case 6: // int_decimal_value
+			return fmt.Sprintf("%d", int32(field.Varint))
+		case 7: // int_hexadecimal_value
+			return fmt.Sprintf("0x%x", uint32(field.Varint))
+		case 8: // boolean_value
+			if field.Varint != 0 {
+				return "true"
+			}
+			return "false"
+		case 9, 10, 11, 12: // colors
+			return fmt.Sprintf("#%08x", uint32(field.Varint))
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,95 @@
+package analyzer
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ResourceQualifiers holds the configuration qualifiers of an Android res/ directory
+type ResourceQualifiers struct {
+	Type    string
+	Locale  string
+	Density string
+}
+
+// Screen density buckets and their dots per inch
+var densityDPIs = map[string]int{
+	"ldpi":    120,
+	"mdpi":    160,
+	"tvdpi":   213,
+	"hdpi":    240,
+	"xhdpi":   320,
+	"xxhdpi":  480,
+	"xxxhdpi": 640,
+}
+
+// densityBuckets lists the density buckets in ascending order
+var densityBuckets = []string{"ldpi", "mdpi", "tvdpi", "hdpi", "xhdpi", "xxhdpi", "xxxhdpi"}
+
+var (
+	languageQualifier = regexp.MustCompile(`^[a-z]{2,3}$`)
+	regionQualifier   = regexp.MustCompile(`^r[A-Z]{2}$`)
+	densityQualifier  = regexp.MustCompile(`^(ldpi|mdpi|tvdpi|hdpi|xhdpi|xxhdpi|xxxhdpi|nodpi|anydpi|\d+dpi)$`)
+)
+
+// uiModeQualifiers are three letter qualifiers that must not be mistaken for a language
+var uiModeQualifiers = map[string]bool{
+	"car": true,
+}
+
+// parseResourceQualifiers parses a res/ directory name like "drawable-fr-rCA-xxhdpi-v21"
+func parseResourceQualifiers(dir string) ResourceQualifiers {
+	parts := strings.Split(path.Base(dir), "-")
+	qualifiers := ResourceQualifiers{Type: parts[0]}
+
+	for i := 1; i < len(parts); i++ {
+		part := parts[i]
+		switch {
+		case strings.HasPrefix(part, "b+"):
+			qualifiers.Locale = strings.ReplaceAll(part[2:], "+", "-")
+		case qualifiers.Locale == "" && languageQualifier.MatchString(part) && !uiModeQualifiers[part]:
+			qualifiers.Locale = part
+			if i+1 < len(parts) && regionQualifier.MatchString(parts[i+1]) {
+				qualifiers.Locale += "-" + parts[i+1][1:]
+				i++
+			}
+		case densityQualifier.MatchString(part):
+			qualifiers.Density = part
+		}
+	}
+
+	return qualifiers
+}
+
+// densityDPI returns the dots per inch of a density qualifier, or 0 for nodpi and anydpi
+func densityDPI(density string) int {
+	if dpi, ok := densityDPIs[density]; ok {
+		return dpi
+	}
+	if strings.HasSuffix(density, "dpi") {
+		if dpi, err := strconv.Atoi(strings.TrimSuffix(density, "dpi")); err == nil {
+			return dpi
+		}
+	}
+	return 0
+}
+
+// densityBucket returns the name of the density bucket closest to the given dpi
+func densityBucket(dpi int) string {
+	best := densityBuckets[0]
+	for _, bucket := range densityBuckets {
+		if abs(densityDPIs[bucket]-dpi) <= abs(densityDPIs[best]-dpi) {
+			best = bucket
+		}
+	}
+	return best
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
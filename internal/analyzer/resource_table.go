@@ -0,0 +1,800 @@
+package analyzer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// ResourceTable is the resources.arsc of an APK, or the resources.pb of an app bundle module,
+// the index of every resource value per configuration
+type ResourceTable struct {
+	Path     string   `json:"path"`
+	Size     int64    `json:"size"`
+	Packages []string `json:"packages"`
+	// StringsSize is the size of the string pools and headers, the rest of the table are the types
+	StringsSize    int64 `json:"strings_size"`
+	Resources      int   `json:"resources"`
+	Values         int   `json:"values"`
+	Configurations int   `json:"configurations"`
+
+	// chunks are the type chunks of the table, values are the entries of every configuration
+	chunks []resourceChunk
+	values []resourceValue
+}
+
+// ResourceBreakdown sums the resource values and res/ files of the resource tables by type and configuration
+type ResourceBreakdown struct {
+	Types          []ResourceGroup `json:"types"`
+	Configurations []ResourceGroup `json:"configurations"`
+	Densities      []ResourceGroup `json:"densities"`
+	Locales        []ResourceGroup `json:"locales"`
+	NightModes     []ResourceGroup `json:"night_modes"`
+	ApiLevels      []ResourceGroup `json:"api_levels"`
+	// Files are the res/ files, by decreasing size, with the resource and configuration they hold
+	Files []ResourceFile `json:"files"`
+	// RedundantValues are values equal to the one of another configuration of the same resource
+	RedundantValues []RedundantResource `json:"redundant_values"`
+	RedundantSize   int64               `json:"redundant_size"`
+}
+
+// ResourceGroup is the size of the values of a resource type or configuration, in the table and in res/ files
+type ResourceGroup struct {
+	Name      string `json:"name"`
+	Values    int    `json:"values"`
+	Files     int    `json:"files"`
+	TableSize int64  `json:"table_size"`
+	FilesSize int64  `json:"files_size"`
+	Size      int64  `json:"size"`
+}
+
+// ResourceFile is a res/ file, with the name and qualifiers of the resource value pointing to it
+type ResourceFile struct {
+	Path       string `json:"path"`
+	Resource   string `json:"resource"`
+	Qualifiers string `json:"qualifiers"`
+	Size       int64  `json:"size"`
+}
+
+// RedundantResource is a value of a configuration equal to the one of the SameAs configuration
+type RedundantResource struct {
+	Resource      string `json:"resource"`
+	Configuration string `json:"configuration"`
+	SameAs        string `json:"same_as"`
+	Size          int64  `json:"size"`
+}
+
+// Chunk types of the resource table, the string pool shares the type of the binary XML one
+const (
+	arscTableType    = 0x0002
+	arscPackageType  = 0x0200
+	arscTypeType     = 0x0201
+	arscTypeSpecType = 0x0202
+)
+
+// Flags of type chunks and their entries
+const (
+	arscTypeFlagSparse   = 0x01
+	arscTypeFlagOffset16 = 0x02
+	arscEntryFlagComplex = 0x0001
+	arscEntryFlagCompact = 0x0008
+)
+
+// defaultConfiguration names the configuration without qualifiers
+const defaultConfiguration = "default"
+
+// resourceConfig is a decoded ResTable_config, the dimensions are empty when unset
+type resourceConfig struct {
+	qualifiers string
+	locale     string
+	density    string
+	nightMode  string
+	apiLevel   string
+}
+
+// resourceChunk is a type spec or type chunk of a package
+type resourceChunk struct {
+	typeName string
+	config   resourceConfig
+	size     int64
+	spec     bool
+}
+
+// resourceValue is an entry of a type chunk, file values point to a res/ file of the APK
+type resourceValue struct {
+	name   string
+	config resourceConfig
+	size   int64
+	// key identifies the value, equal keys hold equal values
+	key      string
+	file     string
+	fileSize int64
+}
+
+// analyzeResourceTable parses the resources.arsc of an APK, files is the analyzed tree of the APK,
+// it returns nil when the APK has no resource table
+func analyzeResourceTable(fsys fs.FS, files *FileInfo) (*ResourceTable, error) {
+	data, err := fs.ReadFile(fsys, "resources.arsc")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read resources.arsc: %v", err)
+	}
+
+	table, err := parseResourceTable(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse resources.arsc: %v", err)
+	}
+	table.Path = "resources.arsc"
+	resolveResourceFiles(table, files, ".")
+
+	return table, nil
+}
+
+// resolveResourceFiles sets the size of the res/ files of the values, dir is the directory the table is in,
+// files are compared by content
+func resolveResourceFiles(table *ResourceTable, files *FileInfo, dir string) {
+	for i := range table.values {
+		value := &table.values[i]
+		if value.file == "" {
+			continue
+		}
+		// Files of other splits are compared by path
+		node := findFileInfo(files, path.Join(dir, value.file))
+		if node == nil || node.Type == "directory" {
+			value.file = ""
+			continue
+		}
+		value.fileSize = node.Size
+		value.key = "file:" + node.Shasum
+	}
+}
+
+// parseResourceTable reads the packages, types, entries and configurations of a resource table
+func parseResourceTable(data []byte) (*ResourceTable, error) {
+	le := binary.LittleEndian
+	if len(data) < 12 || le.Uint16(data[0:2]) != arscTableType {
+		return nil, fmt.Errorf("not a resource table")
+	}
+
+	table := &ResourceTable{
+		Size:     int64(len(data)),
+		Packages: make([]string, 0),
+	}
+
+	var pool stringPool
+	offset := uint64(le.Uint16(data[2:4]))
+	for offset+8 <= uint64(len(data)) {
+		chunkType := le.Uint16(data[offset:])
+		chunkSize := uint64(le.Uint32(data[offset+4:]))
+		if chunkSize < 8 || offset+chunkSize > uint64(len(data)) {
+			return nil, fmt.Errorf("invalid chunk at offset %d", offset)
+		}
+		chunk := data[offset : offset+chunkSize]
+		offset += chunkSize
+
+		switch chunkType {
+		case axmlStringPoolType:
+			var err error
+			if pool, err = parseStringPool(chunk); err != nil {
+				return nil, err
+			}
+		case arscPackageType:
+			if err := parseResourcePackage(chunk, pool, table); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	table.summarize()
+
+	return table, nil
+}
+
+// summarize counts the resources, values and configurations of the parsed chunks and values,
+// what the chunks leave of the table are its string pools and headers
+func (t *ResourceTable) summarize() {
+	t.StringsSize = t.Size
+	names := make(map[string]bool)
+	configurations := make(map[string]bool)
+	for _, chunk := range t.chunks {
+		t.StringsSize -= chunk.size
+		if !chunk.spec {
+			configurations[chunk.config.qualifiers] = true
+		}
+	}
+	for _, value := range t.values {
+		names[value.name] = true
+	}
+	t.Resources = len(names)
+	t.Values = len(t.values)
+	t.Configurations = len(configurations)
+}
+
+// parseResourcePackage reads the type chunks of a package, the names of its types and keys are in its own string pools
+func parseResourcePackage(chunk []byte, pool stringPool, table *ResourceTable) error {
+	le := binary.LittleEndian
+	headerSize := uint64(le.Uint16(chunk[2:4]))
+	if len(chunk) < 284 || headerSize > uint64(len(chunk)) {
+		return fmt.Errorf("package chunk too short")
+	}
+
+	nameUnits := make([]uint16, 0, 128)
+	for i := 12; i < 12+256; i += 2 {
+		unit := le.Uint16(chunk[i:])
+		if unit == 0 {
+			break
+		}
+		nameUnits = append(nameUnits, unit)
+	}
+	table.Packages = append(table.Packages, string(utf16.Decode(nameUnits)))
+	typeStringsOffset := uint64(le.Uint32(chunk[268:]))
+	keyStringsOffset := uint64(le.Uint32(chunk[276:]))
+
+	var typeNames, keyNames stringPool
+	offset := headerSize
+	for offset+8 <= uint64(len(chunk)) {
+		chunkType := le.Uint16(chunk[offset:])
+		chunkSize := uint64(le.Uint32(chunk[offset+4:]))
+		if chunkSize < 8 || offset+chunkSize > uint64(len(chunk)) {
+			return fmt.Errorf("invalid package chunk at offset %d", offset)
+		}
+		child := chunk[offset : offset+chunkSize]
+		childOffset := offset
+		offset += chunkSize
+
+		switch chunkType {
+		case axmlStringPoolType:
+			names, err := parseStringPool(child)
+			if err != nil {
+				return err
+			}
+			switch childOffset {
+			case typeStringsOffset:
+				typeNames = names
+			case keyStringsOffset:
+				keyNames = names
+			}
+		case arscTypeSpecType:
+			if len(child) < 16 {
+				return fmt.Errorf("type spec chunk too short")
+			}
+			table.chunks = append(table.chunks, resourceChunk{
+				typeName: typeNames.get(uint32(child[8]) - 1),
+				size:     int64(chunkSize),
+				spec:     true,
+			})
+		case arscTypeType:
+			if err := parseResourceType(child, pool, typeNames, keyNames, table); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseResourceType reads the entries of a type chunk, the values of one type in one configuration
+func parseResourceType(chunk []byte, pool stringPool, typeNames stringPool, keyNames stringPool, table *ResourceTable) error {
+	le := binary.LittleEndian
+	headerSize := uint64(le.Uint16(chunk[2:4]))
+	if len(chunk) < 24 || headerSize < 20 || headerSize > uint64(len(chunk)) {
+		return fmt.Errorf("type chunk too short")
+	}
+
+	typeName := typeNames.get(uint32(chunk[8]) - 1)
+	flags := chunk[9]
+	entryCount := uint64(le.Uint32(chunk[12:]))
+	entriesStart := uint64(le.Uint32(chunk[16:]))
+	config := parseResourceConfig(chunk[20:headerSize])
+	table.chunks = append(table.chunks, resourceChunk{typeName: typeName, config: config, size: int64(len(chunk))})
+
+	// Offsets of the entries relative to entriesStart, sparse types only list the entries they hold
+	var offsets []uint64
+	for i := uint64(0); i < entryCount; i++ {
+		switch {
+		case flags&arscTypeFlagSparse != 0:
+			if headerSize+i*4+4 > uint64(len(chunk)) {
+				return fmt.Errorf("type entries out of bounds")
+			}
+			offsets = append(offsets, uint64(le.Uint16(chunk[headerSize+i*4+2:]))*4)
+		case flags&arscTypeFlagOffset16 != 0:
+			if headerSize+i*2+2 > uint64(len(chunk)) {
+				return fmt.Errorf("type entries out of bounds")
+			}
+			if entry := le.Uint16(chunk[headerSize+i*2:]); entry != 0xffff {
+				offsets = append(offsets, uint64(entry)*4)
+			}
+		default:
+			if headerSize+i*4+4 > uint64(len(chunk)) {
+				return fmt.Errorf("type entries out of bounds")
+			}
+			if entry := le.Uint32(chunk[headerSize+i*4:]); entry != axmlNoEntry {
+				offsets = append(offsets, uint64(entry))
+			}
+		}
+	}
+
+	for _, entryOffset := range offsets {
+		start := entriesStart + entryOffset
+		if start+8 > uint64(len(chunk)) {
+			return fmt.Errorf("entry out of bounds")
+		}
+		entry := chunk[start:]
+		entrySize := uint64(le.Uint16(entry[0:]))
+		entryFlags := le.Uint16(entry[2:])
+
+		value := resourceValue{config: config}
+		var key uint32
+		var dataType byte
+		var data uint32
+		switch {
+		case entryFlags&arscEntryFlagCompact != 0:
+			// Compact entries hold the key in the size and the data type in the high byte of the flags
+			key = uint32(entrySize)
+			value.size = 8
+			dataType = byte(entryFlags >> 8)
+			data = le.Uint32(entry[4:])
+		case entryFlags&arscEntryFlagComplex != 0:
+			if entrySize < 16 || start+entrySize > uint64(len(chunk)) {
+				return fmt.Errorf("map entry out of bounds")
+			}
+			key = le.Uint32(entry[4:])
+			count := uint64(le.Uint32(entry[12:]))
+			if start+entrySize+count*12 > uint64(len(chunk)) {
+				return fmt.Errorf("map entry out of bounds")
+			}
+			value.size = int64(entrySize + count*12)
+			keys := []string{fmt.Sprintf("bag:%08x", le.Uint32(entry[8:]))}
+			for i := uint64(0); i < count; i++ {
+				item := entry[entrySize+i*12:]
+				keys = append(keys, fmt.Sprintf("%08x=%s", le.Uint32(item[0:]), resourceValueKey(pool, item[7], le.Uint32(item[8:]))))
+			}
+			value.key = strings.Join(keys, ";")
+		default:
+			if entrySize < 8 || start+entrySize+8 > uint64(len(chunk)) {
+				return fmt.Errorf("entry out of bounds")
+			}
+			key = le.Uint32(entry[4:])
+			value.size = int64(entrySize + 8)
+			dataType = entry[entrySize+3]
+			data = le.Uint32(entry[entrySize+4:])
+		}
+		if entryFlags&arscEntryFlagComplex == 0 || entryFlags&arscEntryFlagCompact != 0 {
+			value.key = resourceValueKey(pool, dataType, data)
+			if name := pool.get(data); dataType == axmlTypeString && strings.HasPrefix(name, "res/") {
+				value.file = name
+			}
+		}
+
+		value.name = typeName + "/" + keyNames.get(key)
+		table.values = append(table.values, value)
+	}
+
+	return nil
+}
+
+// resourceValueKey identifies a typed value, strings by their content as every table has its own pool
+func resourceValueKey(pool stringPool, dataType byte, data uint32) string {
+	if dataType == axmlTypeString {
+		return "string:" + pool.get(data)
+	}
+	return fmt.Sprintf("%02x:%08x", dataType, data)
+}
+
+// resourceConfigFields are the dimensions of a configuration, enums hold the ResTable_config values
+type resourceConfigFields struct {
+	mcc, mnc                          int
+	language, script, region, variant string
+	layoutDirection                   int
+	smallestWidthDp, widthDp          int
+	heightDp                          int
+	screenSize, screenLong            int
+	screenRound, orientation          int
+	uiModeType, uiModeNight           int
+	density                           int
+	touchscreen, keysHidden, keyboard int
+	navHidden, navigation             int
+	sdkVersion                        int
+}
+
+// parseResourceConfig decodes a ResTable_config into the qualifiers of its res/ directory, like "fr-rCA-night-xxhdpi-v21"
+func parseResourceConfig(data []byte) resourceConfig {
+	le := binary.LittleEndian
+	if len(data) >= 4 && uint64(le.Uint32(data)) < uint64(len(data)) {
+		data = data[:le.Uint32(data)]
+	}
+	// Fields past the size of older configs are unset
+	u8 := func(offset int) int {
+		if offset >= len(data) {
+			return 0
+		}
+		return int(data[offset])
+	}
+	u16 := func(offset int) int {
+		if offset+2 > len(data) {
+			return 0
+		}
+		return int(le.Uint16(data[offset:]))
+	}
+	text := func(offset, length int) string {
+		if offset+length > len(data) {
+			return ""
+		}
+		return strings.TrimRight(string(data[offset:offset+length]), "\x00")
+	}
+
+	fields := resourceConfigFields{
+		mcc:             u16(4),
+		mnc:             u16(6),
+		language:        unpackLocaleCode(data, 8, 'a'),
+		region:          unpackLocaleCode(data, 10, '0'),
+		script:          text(36, 4),
+		variant:         text(40, 8),
+		layoutDirection: u8(28) & 0xc0,
+		smallestWidthDp: u16(30),
+		widthDp:         u16(32),
+		heightDp:        u16(34),
+		screenSize:      u8(28) & 0x0f,
+		screenLong:      u8(28) & 0x30,
+		screenRound:     u8(48) & 0x03,
+		orientation:     u8(12),
+		uiModeType:      u8(29) & 0x0f,
+		uiModeNight:     u8(29) & 0x30,
+		density:         u16(14),
+		touchscreen:     u8(13),
+		keysHidden:      u8(18) & 0x03,
+		keyboard:        u8(16),
+		navHidden:       u8(18) & 0x0c,
+		navigation:      u8(17),
+		sdkVersion:      u16(24),
+	}
+	if u8(52) != 0 {
+		// Scripts computed from the language aren't part of the qualifiers
+		fields.script = ""
+	}
+	return newResourceConfig(fields)
+}
+
+// newResourceConfig formats the qualifiers of a configuration in the order of res/ directory names
+func newResourceConfig(fields resourceConfigFields) resourceConfig {
+	var config resourceConfig
+	var qualifiers []string
+	if fields.mcc != 0 {
+		qualifiers = append(qualifiers, fmt.Sprintf("mcc%d", fields.mcc))
+	}
+	if fields.mnc != 0 {
+		qualifiers = append(qualifiers, fmt.Sprintf("mnc%02d", fields.mnc))
+	}
+
+	if language := fields.language; language != "" {
+		config.locale = language
+		if fields.script != "" {
+			config.locale += "-" + fields.script
+		}
+		if fields.region != "" {
+			config.locale += "-" + fields.region
+		}
+
+		// Only two letter regions have an "r" qualifier, like "fr-rCA", numeric ones need the BCP 47 form
+		if fields.script == "" && fields.variant == "" && len(fields.region) != 3 {
+			qualifier := language
+			if fields.region != "" {
+				qualifier += "-r" + fields.region
+			}
+			qualifiers = append(qualifiers, qualifier)
+		} else {
+			qualifier := "b+" + language
+			for _, subtag := range []string{fields.script, fields.region, fields.variant} {
+				if subtag != "" {
+					qualifier += "+" + subtag
+				}
+			}
+			qualifiers = append(qualifiers, qualifier)
+		}
+	}
+
+	switch fields.layoutDirection {
+	case 0x40:
+		qualifiers = append(qualifiers, "ldltr")
+	case 0x80:
+		qualifiers = append(qualifiers, "ldrtl")
+	}
+	if fields.smallestWidthDp != 0 {
+		qualifiers = append(qualifiers, fmt.Sprintf("sw%ddp", fields.smallestWidthDp))
+	}
+	if fields.widthDp != 0 {
+		qualifiers = append(qualifiers, fmt.Sprintf("w%ddp", fields.widthDp))
+	}
+	if fields.heightDp != 0 {
+		qualifiers = append(qualifiers, fmt.Sprintf("h%ddp", fields.heightDp))
+	}
+	if size, ok := map[int]string{1: "small", 2: "normal", 3: "large", 4: "xlarge"}[fields.screenSize]; ok {
+		qualifiers = append(qualifiers, size)
+	}
+	if long, ok := map[int]string{0x10: "notlong", 0x20: "long"}[fields.screenLong]; ok {
+		qualifiers = append(qualifiers, long)
+	}
+	if round, ok := map[int]string{1: "notround", 2: "round"}[fields.screenRound]; ok {
+		qualifiers = append(qualifiers, round)
+	}
+	if orientation, ok := map[int]string{1: "port", 2: "land", 3: "square"}[fields.orientation]; ok {
+		qualifiers = append(qualifiers, orientation)
+	}
+	if uiModeType, ok := map[int]string{2: "desk", 3: "car", 4: "television", 5: "appliance", 6: "watch", 7: "vrheadset"}[fields.uiModeType]; ok {
+		qualifiers = append(qualifiers, uiModeType)
+	}
+	if nightMode, ok := map[int]string{0x10: "notnight", 0x20: "night"}[fields.uiModeNight]; ok {
+		config.nightMode = nightMode
+		qualifiers = append(qualifiers, nightMode)
+	}
+
+	switch fields.density {
+	case 0:
+	case 0xfffe:
+		config.density = "anydpi"
+	case 0xffff:
+		config.density = "nodpi"
+	default:
+		config.density = fmt.Sprintf("%ddpi", fields.density)
+		for name, dpi := range densityDPIs {
+			if dpi == fields.density {
+				config.density = name
+			}
+		}
+	}
+	if config.density != "" {
+		qualifiers = append(qualifiers, config.density)
+	}
+
+	if touchscreen, ok := map[int]string{1: "notouch", 2: "stylus", 3: "finger"}[fields.touchscreen]; ok {
+		qualifiers = append(qualifiers, touchscreen)
+	}
+	if keysHidden, ok := map[int]string{1: "keysexposed", 2: "keyshidden", 3: "keyssoft"}[fields.keysHidden]; ok {
+		qualifiers = append(qualifiers, keysHidden)
+	}
+	if keyboard, ok := map[int]string{1: "nokeys", 2: "qwerty", 3: "12key"}[fields.keyboard]; ok {
+		qualifiers = append(qualifiers, keyboard)
+	}
+	if navHidden, ok := map[int]string{0x04: "navexposed", 0x08: "navhidden"}[fields.navHidden]; ok {
+		qualifiers = append(qualifiers, navHidden)
+	}
+	if navigation, ok := map[int]string{1: "nonav", 2: "dpad", 3: "trackball", 4: "wheel"}[fields.navigation]; ok {
+		qualifiers = append(qualifiers, navigation)
+	}
+	if fields.sdkVersion != 0 {
+		config.apiLevel = fmt.Sprintf("v%d", fields.sdkVersion)
+		qualifiers = append(qualifiers, config.apiLevel)
+	}
+
+	config.qualifiers = strings.Join(qualifiers, "-")
+	return config
+}
+
+// unpackLocaleCode reads a two letter language or region code, three letter ones are packed into 15 bits
+func unpackLocaleCode(data []byte, offset int, base byte) string {
+	if offset+2 > len(data) || data[offset] == 0 {
+		return ""
+	}
+	first, second := data[offset], data[offset+1]
+	if first&0x80 == 0 {
+		return string([]byte{first, second})
+	}
+	return string([]byte{
+		base + second&0x1f,
+		base + (second&0xe0)>>5 + (first&0x03)<<3,
+		base + (first&0x7c)>>2,
+	})
+}
+
+// summarizeResources sums the values and res/ files of the tables by type and configuration,
+// and finds the values a configuration repeats from another one
+func summarizeResources(tables []ResourceTable) *ResourceBreakdown {
+	types := newResourceGroups()
+	configurations := newResourceGroups()
+	densities := newResourceGroups()
+	locales := newResourceGroups()
+	nightModes := newResourceGroups()
+	apiLevels := newResourceGroups()
+
+	// Only the dimensions a configuration sets are summed
+	addConfig := func(config resourceConfig, tableSize int64, filesSize int64, values int) {
+		configurations.add(configurationName(config), tableSize, filesSize, values)
+		densities.add(config.density, tableSize, filesSize, values)
+		locales.add(config.locale, tableSize, filesSize, values)
+		nightModes.add(config.nightMode, tableSize, filesSize, values)
+		apiLevels.add(config.apiLevel, tableSize, filesSize, values)
+	}
+
+	breakdown := &ResourceBreakdown{
+		Files:           make([]ResourceFile, 0),
+		RedundantValues: make([]RedundantResource, 0),
+	}
+
+	// Values of every resource in the order of the tables, the default configuration first
+	resourceValues := make(map[string][]resourceValue)
+	var resourceNames []string
+	for _, table := range tables {
+		for _, chunk := range table.chunks {
+			types.add(chunk.typeName, chunk.size, 0, 0)
+			if chunk.spec {
+				continue
+			}
+			addConfig(chunk.config, chunk.size, 0, 0)
+		}
+
+		// The same file may be referenced by several configurations, it is only counted once
+		countedFiles := make(map[string]bool)
+		for _, value := range table.values {
+			var filesSize int64
+			if value.file != "" && !countedFiles[value.file] {
+				countedFiles[value.file] = true
+				filesSize = value.fileSize
+				breakdown.Files = append(breakdown.Files, ResourceFile{
+					Path:       path.Join(path.Dir(table.Path), value.file),
+					Resource:   value.name,
+					Qualifiers: configurationName(value.config),
+					Size:       value.fileSize,
+				})
+			}
+			typeName, _, _ := strings.Cut(value.name, "/")
+			types.add(typeName, 0, filesSize, 1)
+			addConfig(value.config, 0, filesSize, 1)
+
+			if _, ok := resourceValues[value.name]; !ok {
+				resourceNames = append(resourceNames, value.name)
+			}
+			resourceValues[value.name] = append(resourceValues[value.name], value)
+		}
+	}
+
+	for _, name := range resourceNames {
+		values := resourceValues[name]
+		sort.SliceStable(values, func(i, j int) bool {
+			return values[i].config.qualifiers == "" && values[j].config.qualifiers != ""
+		})
+
+		first := make(map[string]resourceValue)
+		seen := make(map[string]bool)
+		for _, value := range values {
+			// Standalone APKs repeat the values of the splits in the same configurations
+			if seen[value.config.qualifiers+"\x00"+value.key] {
+				continue
+			}
+			seen[value.config.qualifiers+"\x00"+value.key] = true
+
+			original, ok := first[value.key]
+			if !ok {
+				first[value.key] = value
+				continue
+			}
+
+			size := value.size
+			if value.file != "" && value.file != original.file {
+				size += value.fileSize
+			}
+			breakdown.RedundantSize += size
+			breakdown.RedundantValues = append(breakdown.RedundantValues, RedundantResource{
+				Resource:      name,
+				Configuration: configurationName(value.config),
+				SameAs:        configurationName(original.config),
+				Size:          size,
+			})
+		}
+	}
+
+	breakdown.Types = types.sorted()
+	breakdown.Configurations = configurations.sorted()
+	breakdown.Densities = densities.sorted()
+	breakdown.Locales = locales.sorted()
+	breakdown.NightModes = nightModes.sorted()
+	breakdown.ApiLevels = apiLevels.sorted()
+
+	sort.SliceStable(breakdown.Files, func(i, j int) bool {
+		return breakdown.Files[i].Size > breakdown.Files[j].Size
+	})
+	sort.SliceStable(breakdown.RedundantValues, func(i, j int) bool {
+		return breakdown.RedundantValues[i].Size > breakdown.RedundantValues[j].Size
+	})
+	if len(breakdown.RedundantValues) > maxAttributedEntries {
+		breakdown.RedundantValues = breakdown.RedundantValues[:maxAttributedEntries]
+	}
+
+	return breakdown
+}
+
+// configurationName returns the qualifiers of a configuration, or "default" when it has none
+func configurationName(config resourceConfig) string {
+	if config.qualifiers == "" {
+		return defaultConfiguration
+	}
+	return config.qualifiers
+}
+
+// resourceGroups sums resource values by name, in the order the names are first seen
+type resourceGroups struct {
+	groups map[string]*ResourceGroup
+	names  []string
+}
+
+func newResourceGroups() *resourceGroups {
+	return &resourceGroups{groups: make(map[string]*ResourceGroup)}
+}
+
+// add adds the size of a chunk or of a value of the group, groups without a name are skipped
+func (g *resourceGroups) add(name string, tableSize int64, filesSize int64, values int) {
+	if name == "" {
+		return
+	}
+	group, ok := g.groups[name]
+	if !ok {
+		group = &ResourceGroup{Name: name}
+		g.groups[name] = group
+		g.names = append(g.names, name)
+	}
+	group.Values += values
+	group.TableSize += tableSize
+	group.FilesSize += filesSize
+	group.Size += tableSize + filesSize
+	if filesSize > 0 {
+		group.Files++
+	}
+}
+
+// sorted returns the groups by decreasing size
+func (g *resourceGroups) sorted() []ResourceGroup {
+	sorted := make([]ResourceGroup, 0, len(g.names))
+	for _, name := range g.names {
+		sorted = append(sorted, *g.groups[name])
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Size > sorted[j].Size
+	})
+	return sorted
+}
+
+// resourceTableNodes returns the nodes of the string pools and of the types of a table,
+// the types hold one node per configuration
+func resourceTableNodes(table ResourceTable) []FileInfo {
+	nodes := []FileInfo{{
+		RelativePath: path.Join(table.Path, "(strings)"),
+		Size:         table.StringsSize,
+		Type:         "resource_strings",
+	}}
+
+	index := make(map[string]int)
+	for _, chunk := range table.chunks {
+		i, ok := index[chunk.typeName]
+		if !ok {
+			nodes = append(nodes, FileInfo{
+				RelativePath: path.Join(table.Path, chunk.typeName),
+				Type:         "resource_type",
+			})
+			i = len(nodes) - 1
+			index[chunk.typeName] = i
+		}
+		nodes[i].Size += chunk.size
+		if chunk.spec {
+			continue
+		}
+
+		// Packages may share type names and configurations
+		configPath := path.Join(nodes[i].RelativePath, configurationName(chunk.config))
+		if child := findFileInfo(&nodes[i], configPath); child != nil {
+			child.Size += chunk.size
+			continue
+		}
+		nodes[i].Children = append(nodes[i].Children, FileInfo{
+			RelativePath: configPath,
+			Size:         chunk.size,
+			Type:         "resource_config",
+		})
+	}
+
+	return nodes
+}
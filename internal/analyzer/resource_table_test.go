@@ -0,0 +1,541 @@
+package analyzer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// testConfigField sets a field of a 64 byte ResTable_config
+type testConfigField struct {
+	offset int
+	value  []byte
+}
+
+func testConfig(fields ...testConfigField) []byte {
+	config := make([]byte, 64)
+	binary.LittleEndian.PutUint32(config, 64)
+	for _, field := range fields {
+		copy(config[field.offset:], field.value)
+	}
+	return config
+}
+
+func testLocale(language, region string) testConfigField {
+	value := make([]byte, 4)
+	copy(value, language)
+	copy(value[2:], testPackedLocaleCode(region, '0'))
+	return testConfigField{8, value}
+}
+
+// testPackedLocaleCode packs three letter codes into two bytes, two letter ones are stored as they are
+func testPackedLocaleCode(code string, base byte) []byte {
+	if len(code) != 3 {
+		return []byte(code)
+	}
+	c0, c1, c2 := code[0]-base, code[1]-base, code[2]-base
+	return []byte{0x80 | c2<<2 | c1>>3, (c1&0x07)<<5 | c0}
+}
+
+func testU16(offset int, value uint16) testConfigField {
+	return testConfigField{offset, binary.LittleEndian.AppendUint16(nil, value)}
+}
+
+func testU8(offset int, value byte) testConfigField {
+	return testConfigField{offset, []byte{value}}
+}
+
+// testResourceEntry is an entry of a type chunk, simple entries hold a value and complex ones a map
+type testResourceEntry struct {
+	key      uint32
+	dataType byte
+	data     uint32
+	compact  bool
+	mapItems [][2]uint32
+}
+
+func (e testResourceEntry) bytes() []byte {
+	le := binary.LittleEndian
+	switch {
+	case e.compact:
+		entry := le.AppendUint16(nil, uint16(e.key))
+		entry = le.AppendUint16(entry, arscEntryFlagCompact|uint16(e.dataType)<<8)
+		return le.AppendUint32(entry, e.data)
+	case e.mapItems != nil:
+		entry := le.AppendUint16(nil, 16)
+		entry = le.AppendUint16(entry, arscEntryFlagComplex)
+		entry = le.AppendUint32(entry, e.key)
+		entry = le.AppendUint32(entry, 0)
+		entry = le.AppendUint32(entry, uint32(len(e.mapItems)))
+		for _, item := range e.mapItems {
+			entry = le.AppendUint32(entry, item[0])
+			entry = append(entry, 8, 0, 0, axmlTypeIntDec)
+			entry = le.AppendUint32(entry, item[1])
+		}
+		return entry
+	}
+	entry := le.AppendUint16(nil, 8)
+	entry = le.AppendUint16(entry, 0)
+	entry = le.AppendUint32(entry, e.key)
+	entry = append(entry, 8, 0, 0, e.dataType)
+	return le.AppendUint32(entry, e.data)
+}
+
+func testTypeSpec(typeID byte, entryCount int) []byte {
+	header := []byte{typeID, 0, 0, 0}
+	header = binary.LittleEndian.AppendUint32(header, uint32(entryCount))
+	return testChunk(arscTypeSpecType, header, make([]byte, entryCount*4))
+}
+
+// testType assembles a type chunk, nil entries are missing from the configuration
+func testType(typeID byte, config []byte, entries ...*testResourceEntry) []byte {
+	le := binary.LittleEndian
+	var offsets, data []byte
+	for _, entry := range entries {
+		if entry == nil {
+			offsets = le.AppendUint32(offsets, axmlNoEntry)
+			continue
+		}
+		offsets = le.AppendUint32(offsets, uint32(len(data)))
+		data = append(data, entry.bytes()...)
+	}
+
+	header := []byte{typeID, 0, 0, 0}
+	header = le.AppendUint32(header, uint32(len(entries)))
+	header = le.AppendUint32(header, uint32(8+12+len(config)+len(offsets)))
+	header = append(header, config...)
+	return testChunk(arscTypeType, header, append(offsets, data...))
+}
+
+func testPackage(name string, typeNames []string, keyNames []string, chunks ...[]byte) []byte {
+	le := binary.LittleEndian
+	header := le.AppendUint32(nil, 0x7f)
+	units := utf16.Encode([]rune(name))
+	for i := 0; i < 128; i++ {
+		var unit uint16
+		if i < len(units) {
+			unit = units[i]
+		}
+		header = le.AppendUint16(header, unit)
+	}
+
+	typeStrings := testStringPool(false, typeNames...)
+	keyStrings := testStringPool(false, keyNames...)
+	header = le.AppendUint32(header, 288)
+	header = le.AppendUint32(header, uint32(len(typeNames)))
+	header = le.AppendUint32(header, uint32(288+len(typeStrings)))
+	header = le.AppendUint32(header, uint32(len(keyNames)))
+	header = le.AppendUint32(header, 0)
+
+	body := append(typeStrings, keyStrings...)
+	for _, chunk := range chunks {
+		body = append(body, chunk...)
+	}
+	return testChunk(arscPackageType, header, body)
+}
+
+func testResourceTableChunk(chunks ...[]byte) []byte {
+	var body []byte
+	for _, chunk := range chunks {
+		body = append(body, chunk...)
+	}
+	return testChunk(arscTableType, binary.LittleEndian.AppendUint32(nil, 1), body)
+}
+
+// testResourceTable holds strings in the default and French configurations, an icon in two densities and a style
+func testResourceTable() []byte {
+	const (
+		calc = iota
+		hello
+		bonjour
+		iconHdpi
+		iconXxhdpi
+	)
+	const (
+		appName = iota
+		greeting
+		icon
+		appTheme
+	)
+	hdpi := testU16(14, 240)
+	xxhdpi := testU16(14, 480)
+	return testResourceTableChunk(
+		testStringPool(true, "Calc", "Hello", "Bonjour", "res/drawable-hdpi/icon.png", "res/drawable-xxhdpi/icon.png"),
+		testPackage("com.example", []string{"string", "drawable", "style"}, []string{"app_name", "greeting", "icon", "AppTheme"},
+			testTypeSpec(1, 2),
+			testType(1, testConfig(),
+				&testResourceEntry{key: appName, dataType: axmlTypeString, data: calc},
+				&testResourceEntry{key: greeting, dataType: axmlTypeString, data: hello}),
+			testType(1, testConfig(testLocale("fr", "")),
+				&testResourceEntry{key: appName, dataType: axmlTypeString, data: calc},
+				&testResourceEntry{key: greeting, dataType: axmlTypeString, data: bonjour}),
+			testTypeSpec(2, 1),
+			testType(2, testConfig(hdpi), &testResourceEntry{key: icon, dataType: axmlTypeString, data: iconHdpi}),
+			testType(2, testConfig(xxhdpi), &testResourceEntry{key: icon, dataType: axmlTypeString, data: iconXxhdpi, compact: true}),
+			testTypeSpec(3, 1),
+			testType(3, testConfig(), &testResourceEntry{key: appTheme, mapItems: [][2]uint32{{0x01010036, 1}}}),
+		),
+	)
+}
+
+type testValue struct {
+	name, qualifiers, key, file string
+	size                        int64
+}
+
+func testValues(table *ResourceTable) []testValue {
+	var values []testValue
+	for _, value := range table.values {
+		values = append(values, testValue{value.name, value.config.qualifiers, value.key, value.file, value.size})
+	}
+	return values
+}
+
+func TestParseResourceTable(t *testing.T) {
+	data := testResourceTable()
+	table, err := parseResourceTable(data)
+	if err != nil {
+		t.Fatalf("parseResourceTable() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(table.Packages, []string{"com.example"}) {
+		t.Errorf("parseResourceTable() packages = %v", table.Packages)
+	}
+	if table.Resources != 4 || table.Values != 7 || table.Configurations != 4 {
+		t.Errorf("parseResourceTable() = %d resources, %d values and %d configurations, want 4, 7 and 4",
+			table.Resources, table.Values, table.Configurations)
+	}
+
+	wantValues := []testValue{
+		{"string/app_name", "", "string:Calc", "", 16},
+		{"string/greeting", "", "string:Hello", "", 16},
+		{"string/app_name", "fr", "string:Calc", "", 16},
+		{"string/greeting", "fr", "string:Bonjour", "", 16},
+		{"drawable/icon", "hdpi", "string:res/drawable-hdpi/icon.png", "res/drawable-hdpi/icon.png", 16},
+		{"drawable/icon", "xxhdpi", "string:res/drawable-xxhdpi/icon.png", "res/drawable-xxhdpi/icon.png", 8},
+		{"style/AppTheme", "", "bag:00000000;01010036=10:00000001", "", 28},
+	}
+	if got := testValues(table); !reflect.DeepEqual(got, wantValues) {
+		t.Errorf("parseResourceTable() values = %v, want %v", got, wantValues)
+	}
+
+	// The chunks of the types and what is left, the table header and its string pools, add up to the table
+	size := table.StringsSize
+	for _, chunk := range table.chunks {
+		size += chunk.size
+	}
+	if size != int64(len(data)) || table.StringsSize <= 0 {
+		t.Errorf("parseResourceTable() chunks and strings add up to %d, want %d", size, len(data))
+	}
+}
+
+func TestSummarizeResources(t *testing.T) {
+	table, err := parseResourceTable(testResourceTable())
+	if err != nil {
+		t.Fatalf("parseResourceTable() error = %v", err)
+	}
+	table.Path = "resources.arsc"
+	files := &FileInfo{RelativePath: ".", Type: "directory", Children: []FileInfo{
+		{RelativePath: "res", Type: "directory", Children: []FileInfo{
+			{RelativePath: "res/drawable-hdpi", Type: "directory", Children: []FileInfo{
+				{RelativePath: "res/drawable-hdpi/icon.png", Size: 100, Shasum: "hdpi", Type: "file"},
+			}},
+			{RelativePath: "res/drawable-xxhdpi", Type: "directory", Children: []FileInfo{
+				{RelativePath: "res/drawable-xxhdpi/icon.png", Size: 300, Shasum: "xxhdpi", Type: "file"},
+			}},
+		}},
+	}}
+	resolveResourceFiles(table, files, ".")
+
+	breakdown := summarizeResources([]ResourceTable{*table})
+
+	wantFiles := []ResourceFile{
+		{Path: "res/drawable-xxhdpi/icon.png", Resource: "drawable/icon", Qualifiers: "xxhdpi", Size: 300},
+		{Path: "res/drawable-hdpi/icon.png", Resource: "drawable/icon", Qualifiers: "hdpi", Size: 100},
+	}
+	if !reflect.DeepEqual(breakdown.Files, wantFiles) {
+		t.Errorf("summarizeResources() files = %+v, want %+v", breakdown.Files, wantFiles)
+	}
+
+	wantRedundant := []RedundantResource{{Resource: "string/app_name", Configuration: "fr", SameAs: "default", Size: 16}}
+	if !reflect.DeepEqual(breakdown.RedundantValues, wantRedundant) || breakdown.RedundantSize != 16 {
+		t.Errorf("summarizeResources() redundant values = %+v, want %+v", breakdown.RedundantValues, wantRedundant)
+	}
+
+	groupNames := func(groups []ResourceGroup) []string {
+		var names []string
+		for _, group := range groups {
+			names = append(names, group.Name)
+		}
+		return names
+	}
+	if got := groupNames(breakdown.Densities); !reflect.DeepEqual(got, []string{"xxhdpi", "hdpi"}) {
+		t.Errorf("summarizeResources() densities = %v", got)
+	}
+	if got := groupNames(breakdown.Locales); !reflect.DeepEqual(got, []string{"fr"}) {
+		t.Errorf("summarizeResources() locales = %v", got)
+	}
+	if got := groupNames(breakdown.Types); !reflect.DeepEqual(got, []string{"drawable", "string", "style"}) {
+		t.Errorf("summarizeResources() types = %v", got)
+	}
+}
+
+func TestParseResourceConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config []byte
+		want   resourceConfig
+	}{
+		{name: "default", config: testConfig(), want: resourceConfig{}},
+		{
+			name:   "language and region",
+			config: testConfig(testLocale("fr", "CA")),
+			want:   resourceConfig{qualifiers: "fr-rCA", locale: "fr-CA"},
+		},
+		{
+			name:   "numeric region",
+			config: testConfig(testLocale("es", "419")),
+			want:   resourceConfig{qualifiers: "b+es+419", locale: "es-419"},
+		},
+		{
+			name:   "script",
+			config: testConfig(testLocale("sr", ""), testConfigField{36, []byte("Latn")}),
+			want:   resourceConfig{qualifiers: "b+sr+Latn", locale: "sr-Latn"},
+		},
+		{
+			name:   "computed script",
+			config: testConfig(testLocale("sr", ""), testConfigField{36, []byte("Cyrl")}, testU8(52, 1)),
+			want:   resourceConfig{qualifiers: "sr", locale: "sr"},
+		},
+		{
+			name:   "night mode, density and API level",
+			config: testConfig(testU8(29, 0x20), testU16(14, 480), testU16(24, 21)),
+			want:   resourceConfig{qualifiers: "night-xxhdpi-v21", density: "xxhdpi", nightMode: "night", apiLevel: "v21"},
+		},
+		{
+			name:   "screen",
+			config: testConfig(testU8(28, 0x80|0x03), testU16(30, 600), testU8(12, 2)),
+			want:   resourceConfig{qualifiers: "ldrtl-sw600dp-large-land"},
+		},
+		{
+			name:   "network and other densities",
+			config: testConfig(testU16(4, 310), testU16(6, 4), testU16(14, 0xfffe)),
+			want:   resourceConfig{qualifiers: "mcc310-mnc04-anydpi", density: "anydpi"},
+		},
+		{
+			// Configs written before the screen layout fields were added
+			name:   "short config",
+			config: append(binary.LittleEndian.AppendUint32(nil, 28), testConfig(testU16(14, 160), testU8(28, 0x03))[4:]...),
+			want:   resourceConfig{qualifiers: "mdpi", density: "mdpi"},
+		},
+		{name: "truncated", config: []byte{64, 0, 0}, want: resourceConfig{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseResourceConfig(tt.config); got != tt.want {
+				t.Errorf("parseResourceConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseResourceTableMalformed(t *testing.T) {
+	le := binary.LittleEndian
+	table := testResourceTable()
+	// The string pool of the values follows the table header, the package follows the string pool
+	poolEnd := 12 + le.Uint32(table[12+4:])
+
+	shortTypeHeader := testType(1, testConfig(), &testResourceEntry{key: 0, dataType: axmlTypeString})
+	le.PutUint16(shortTypeHeader[2:], 16)
+
+	entryPastEnd := testType(1, testConfig(), &testResourceEntry{key: 0, dataType: axmlTypeString})
+	le.PutUint32(entryPastEnd[8+12+64:], 1000)
+
+	mapPastEnd := testType(1, testConfig(), &testResourceEntry{key: 0, mapItems: [][2]uint32{{1, 1}}})
+	le.PutUint32(mapPastEnd[len(mapPastEnd)-12-4:], 1000)
+
+	tooManyEntries := testType(1, testConfig(), &testResourceEntry{key: 0, dataType: axmlTypeString})
+	le.PutUint32(tooManyEntries[12:], 1000)
+
+	chunkPastEnd := testTypeSpec(1, 1)
+	le.PutUint32(chunkPastEnd[4:], 1000)
+
+	inPackage := func(chunks ...[]byte) []byte {
+		return testResourceTableChunk(testPackage("com.example", []string{"string"}, []string{"key"}, chunks...))
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{name: "binary XML", data: testBinaryXML(), want: "not a resource table"},
+		{name: "string pool cut short", data: table[:poolEnd-1], want: "invalid chunk at offset 12"},
+		{name: "package cut short", data: table[:len(table)-1], want: fmt.Sprintf("invalid chunk at offset %d", poolEnd)},
+		{name: "short package", data: testResourceTableChunk(testChunk(arscPackageType, make([]byte, 4), nil)), want: "package chunk too short"},
+		{name: "short type header", data: inPackage(shortTypeHeader), want: "type chunk too short"},
+		{name: "short type spec", data: inPackage(testChunk(arscTypeSpecType, []byte{1, 0, 0, 0}, nil)), want: "type spec chunk too short"},
+		{name: "entry past the end", data: inPackage(entryPastEnd), want: "entry out of bounds"},
+		{name: "map entry past the end", data: inPackage(mapPastEnd), want: "map entry out of bounds"},
+		{name: "entry offsets past the end", data: inPackage(tooManyEntries), want: "type entries out of bounds"},
+		{name: "package chunk past its end", data: inPackage(chunkPastEnd), want: "invalid package chunk"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseResourceTable(tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseResourceTable() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// testProtoField encodes a length delimited protobuf field
+func testProtoField(number int, data []byte) []byte {
+	field := binary.AppendUvarint(nil, uint64(number<<3|protoBytes))
+	field = binary.AppendUvarint(field, uint64(len(data)))
+	return append(field, data...)
+}
+
+func testProtoVarint(number int, value uint64) []byte {
+	field := binary.AppendUvarint(nil, uint64(number<<3|protoVarint))
+	return binary.AppendUvarint(field, value)
+}
+
+func testProtoMessage(fields ...[]byte) []byte {
+	var message []byte
+	for _, field := range fields {
+		message = append(message, field...)
+	}
+	return message
+}
+
+// testProtoConfigValue is a ConfigValue holding an Item of the configuration
+func testProtoConfigValue(config []byte, item []byte) []byte {
+	return testProtoField(6, testProtoMessage(
+		testProtoField(1, config),
+		testProtoField(2, testProtoField(4, item)),
+	))
+}
+
+func testProtoResourceTable() []byte {
+	str := func(value string) []byte {
+		return testProtoField(2, testProtoField(1, []byte(value)))
+	}
+	file := func(path string) []byte {
+		return testProtoField(5, testProtoField(1, []byte(path)))
+	}
+	locale := func(tag string) []byte {
+		return testProtoField(3, []byte(tag))
+	}
+
+	stringType := testProtoMessage(
+		testProtoField(2, []byte("string")),
+		testProtoField(3, testProtoMessage(
+			testProtoField(2, []byte("app_name")),
+			testProtoConfigValue(nil, str("Calc")),
+			testProtoConfigValue(locale("fr-CA"), str("Calc")),
+			testProtoConfigValue(locale("sr-Latn"), str("Калк")),
+			testProtoConfigValue(locale("es-419"), str("Calculadora")),
+		)),
+	)
+	drawableType := testProtoMessage(
+		testProtoField(2, []byte("drawable")),
+		testProtoField(3, testProtoMessage(
+			testProtoField(2, []byte("icon")),
+			testProtoConfigValue(testProtoVarint(18, 240), file("res/drawable-hdpi/icon.png")),
+			testProtoConfigValue(testProtoMessage(testProtoVarint(17, 1), testProtoVarint(18, 480), testProtoVarint(24, 21)),
+				file("res/drawable-night-xxhdpi-v21/icon.png")),
+		)),
+	)
+	return testProtoField(2, testProtoMessage(
+		testProtoField(2, []byte("com.example")),
+		testProtoField(3, stringType),
+		testProtoField(3, drawableType),
+	))
+}
+
+func TestParseProtoResourceTable(t *testing.T) {
+	data := testProtoResourceTable()
+	table, err := parseProtoResourceTable(data)
+	if err != nil {
+		t.Fatalf("parseProtoResourceTable() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(table.Packages, []string{"com.example"}) {
+		t.Errorf("parseProtoResourceTable() packages = %v", table.Packages)
+	}
+	if table.Resources != 2 || table.Values != 6 || table.Configurations != 6 {
+		t.Errorf("parseProtoResourceTable() = %d resources, %d values and %d configurations, want 2, 6 and 6",
+			table.Resources, table.Values, table.Configurations)
+	}
+
+	type value struct {
+		name, qualifiers, locale, file string
+	}
+	var got []value
+	for _, v := range table.values {
+		got = append(got, value{v.name, v.config.qualifiers, v.config.locale, v.file})
+		if v.size <= 0 || v.key == "" {
+			t.Errorf("value %s of %s has size %d and key %q", v.name, v.config.qualifiers, v.size, v.key)
+		}
+	}
+	want := []value{
+		{"string/app_name", "", "", ""},
+		{"string/app_name", "fr-rCA", "fr-CA", ""},
+		{"string/app_name", "b+sr+Latn", "sr-Latn", ""},
+		{"string/app_name", "b+es+419", "es-419", ""},
+		{"drawable/icon", "hdpi", "", "res/drawable-hdpi/icon.png"},
+		{"drawable/icon", "night-xxhdpi-v21", "", "res/drawable-night-xxhdpi-v21/icon.png"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseProtoResourceTable() values = %v, want %v", got, want)
+	}
+	if table.values[0].key != table.values[1].key || table.values[0].key == table.values[2].key {
+		t.Errorf("parseProtoResourceTable() keys don't tell values apart")
+	}
+
+	size := table.StringsSize
+	for _, chunk := range table.chunks {
+		size += chunk.size
+	}
+	if size != int64(len(data)) {
+		t.Errorf("parseProtoResourceTable() chunks and strings add up to %d, want %d", size, len(data))
+	}
+}
+
+func TestParseProtoResourceTableMalformed(t *testing.T) {
+	table := testProtoResourceTable()
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{name: "truncated field", data: []byte{0x12, 0x05, 0x12}, want: "failed to parse resource table"},
+		{name: "package cut short", data: table[:len(table)-1], want: "failed to parse resource table"},
+		{name: "invalid package", data: testProtoField(2, []byte{0x12, 0x05}), want: "failed to parse package"},
+		{name: "invalid type", data: testProtoField(2, testProtoField(3, []byte{0xff})), want: "failed to parse resource type"},
+		{
+			name: "invalid entry",
+			data: testProtoField(2, testProtoField(3, testProtoField(3, []byte{0x0f}))),
+			want: "failed to parse resource entry",
+		},
+		{
+			name: "invalid value",
+			data: testProtoField(2, testProtoField(3, testProtoField(3, testProtoField(6, []byte{0x0a, 0x09})))),
+			want: "failed to parse value",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseProtoResourceTable(tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseProtoResourceTable() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package analyzer
+
+import (
+	"debug/macho"
+	"sort"
+)
+
+// CodeAttribution breaks the sections of a Mach-O binary down by the symbols they hold,
+// grouped by the Swift module or C++ namespace, the type and the Objective-C class they belong to
+type CodeAttribution struct {
+	Binary       string `json:"binary"`
+	Architecture string `json:"architecture"`
+	// SectionsSize is the size of the sections symbols are looked up in
+	SectionsSize int64 `json:"sections_size"`
+	// AttributedSize is the part of the sections covered by a symbol, stripped binaries only keep a few
+	AttributedSize int64             `json:"attributed_size"`
+	Modules        []AttributedGroup `json:"modules"`
+	Types          []AttributedGroup `json:"types"`
+	ObjCClasses    []AttributedGroup `json:"objc_classes"`
+	Symbols        []SymbolSize      `json:"symbols"`
+}
+
+// AttributedGroup is the size of the symbols of a module, a type or a class
+type AttributedGroup struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	Symbols int    `json:"symbols"`
+}
+
+// SymbolSize is the size of a symbol, from its address to the next symbol of its section
+type SymbolSize struct {
+	Name        string `json:"name"`
+	MangledName string `json:"mangled_name"`
+	Section     string `json:"section"`
+	Size        int64  `json:"size"`
+}
+
+// maxAttributedEntries limits the groups and symbols reported per binary
+const maxAttributedEntries = 100
+
+// Symbol table entry types, see <mach-o/nlist.h>
+const (
+	nStab     = 0xe0
+	nTypeMask = 0x0e
+	nSect     = 0x0e
+)
+
+// attributeCode computes the size of every symbol defined in a section of the slice,
+// symbols sharing an address are aliases and the first one gets the size
+func attributeCode(f *macho.File, binary string, arch string) *CodeAttribution {
+	attribution := &CodeAttribution{
+		Binary:       binary,
+		Architecture: arch,
+		Modules:      make([]AttributedGroup, 0),
+		Types:        make([]AttributedGroup, 0),
+		ObjCClasses:  make([]AttributedGroup, 0),
+		Symbols:      make([]SymbolSize, 0),
+	}
+
+	// Symbols by the section they are defined in
+	sectionSymbols := make(map[int][]macho.Symbol)
+	for i, section := range f.Sections {
+		switch section.Flags & sectionTypeMask {
+		case sZeroFill, sGBZeroFill, sThreadLocalZeroFill:
+			continue
+		}
+		attribution.SectionsSize += int64(section.Size)
+		sectionSymbols[i] = nil
+	}
+	if f.Symtab == nil {
+		return attribution
+	}
+	for _, symbol := range f.Symtab.Syms {
+		if symbol.Type&nStab != 0 || symbol.Type&nTypeMask != nSect || symbol.Sect == 0 {
+			continue
+		}
+		index := int(symbol.Sect) - 1
+		symbols, ok := sectionSymbols[index]
+		if !ok {
+			continue
+		}
+		// Symbols outside of their section, like __mh_execute_header, cover no code
+		section := f.Sections[index]
+		if symbol.Value < section.Addr || symbol.Value >= section.Addr+section.Size {
+			continue
+		}
+		sectionSymbols[index] = append(symbols, symbol)
+	}
+
+	modules := make(map[string]*AttributedGroup)
+	types := make(map[string]*AttributedGroup)
+	classes := make(map[string]*AttributedGroup)
+	add := func(groups map[string]*AttributedGroup, name string, size int64) {
+		if name == "" {
+			return
+		}
+		group, ok := groups[name]
+		if !ok {
+			group = &AttributedGroup{Name: name}
+			groups[name] = group
+		}
+		group.Size += size
+		group.Symbols++
+	}
+
+	for index, symbols := range sectionSymbols {
+		section := f.Sections[index]
+		sort.Slice(symbols, func(i, j int) bool {
+			if symbols[i].Value != symbols[j].Value {
+				return symbols[i].Value < symbols[j].Value
+			}
+			return symbols[i].Name < symbols[j].Name
+		})
+
+		for i, symbol := range symbols {
+			if i > 0 && symbols[i-1].Value == symbol.Value {
+				continue
+			}
+			end := section.Addr + section.Size
+			for _, next := range symbols[i+1:] {
+				if next.Value != symbol.Value {
+					end = next.Value
+					break
+				}
+			}
+			size := int64(end - symbol.Value)
+			attribution.AttributedSize += size
+
+			demangled := demangleSymbol(symbol.Name)
+			add(modules, symbolModule(demangled), size)
+			add(types, demangled.Type, size)
+			add(classes, demangled.ObjCClass, size)
+			attribution.Symbols = append(attribution.Symbols, SymbolSize{
+				Name:        demangled.Name,
+				MangledName: symbol.Name,
+				Section:     section.Seg + "," + section.Name,
+				Size:        size,
+			})
+		}
+	}
+
+	attribution.Modules = largestGroups(modules)
+	attribution.Types = largestGroups(types)
+	attribution.ObjCClasses = largestGroups(classes)
+
+	sort.Slice(attribution.Symbols, func(i, j int) bool {
+		if attribution.Symbols[i].Size != attribution.Symbols[j].Size {
+			return attribution.Symbols[i].Size > attribution.Symbols[j].Size
+		}
+		return attribution.Symbols[i].MangledName < attribution.Symbols[j].MangledName
+	})
+	if len(attribution.Symbols) > maxAttributedEntries {
+		attribution.Symbols = attribution.Symbols[:maxAttributedEntries]
+	}
+
+	return attribution
+}
+
+// symbolModule returns the module a symbol is attributed to, symbols of languages without modules are grouped by language
+func symbolModule(symbol symbolName) string {
+	if symbol.Module != "" {
+		return symbol.Module
+	}
+	switch symbol.Language {
+	case "objc":
+		return "(Objective-C)"
+	case "c++":
+		return "(C++)"
+	case "swift":
+		return "(Swift)"
+	}
+	return "(C)"
+}
+
+// largestGroups returns the largest groups, by decreasing size
+func largestGroups(groups map[string]*AttributedGroup) []AttributedGroup {
+	sorted := make([]AttributedGroup, 0, len(groups))
+	for _, group := range groups {
+		sorted = append(sorted, *group)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Size != sorted[j].Size {
+			return sorted[i].Size > sorted[j].Size
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	if len(sorted) > maxAttributedEntries {
+		sorted = sorted[:maxAttributedEntries]
+	}
+	return sorted
+}
+
+// preferredArchitecture returns the slice attribution is computed for, the one App Store devices run
+func preferredArchitecture(architectures []string) string {
+	for _, preferred := range []string{"arm64", "arm64e"} {
+		for _, arch := range architectures {
+			if arch == preferred {
+				return arch
+			}
+		}
+	}
+	if len(architectures) > 0 {
+		return architectures[0]
+	}
+	return ""
+}
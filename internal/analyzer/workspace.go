@@ -0,0 +1,53 @@
+package analyzer
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Workspace owns every scratch directory of a single analysis run,
+// so they can be removed together however the run ends
+type Workspace struct {
+	root    string
+	keep    bool
+	cleanup sync.Once
+}
+
+// NewWorkspace creates the root directory of the workspace, when keep is set
+// its contents are left on disk after the run for debugging
+func NewWorkspace(keep bool) (*Workspace, error) {
+	root, err := os.MkdirTemp("", "bitrise-analyze-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %v", err)
+	}
+
+	return &Workspace{root: root, keep: keep}, nil
+}
+
+// Path returns the root directory of the workspace
+func (w *Workspace) Path() string {
+	return w.root
+}
+
+// TempDir creates a new scratch directory inside the workspace
+func (w *Workspace) TempDir(pattern string) (string, error) {
+	dir, err := os.MkdirTemp(w.root, pattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %v", err)
+	}
+	return dir, nil
+}
+
+// Cleanup removes the workspace unless it is kept, it is safe to call more than once
+func (w *Workspace) Cleanup() error {
+	var err error
+	w.cleanup.Do(func() {
+		if w.keep {
+			fmt.Printf("Keeping work directory: %s\n", w.root)
+			return
+		}
+		err = os.RemoveAll(w.root)
+	})
+	return err
+}
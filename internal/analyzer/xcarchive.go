@@ -0,0 +1,271 @@
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// XcarchiveInfo holds what an .xcarchive records besides the app itself
+type XcarchiveInfo struct {
+	Name            string           `json:"name,omitempty"`
+	SchemeName      string           `json:"scheme_name,omitempty"`
+	CreationDate    string           `json:"creation_date,omitempty"`
+	SigningIdentity string           `json:"signing_identity,omitempty"`
+	Team            string           `json:"team,omitempty"`
+	Products        []ArchiveProduct `json:"products"`
+	DSYMs           []DSYMInfo       `json:"dsyms"`
+	// MissingDSYMs lists the binaries of the app no dSYM matches, their crashes can't be symbolicated
+	MissingDSYMs []string `json:"missing_dsyms,omitempty"`
+}
+
+// ArchiveProduct is a product stored under the Products directory of the archive
+type ArchiveProduct struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// DSYMInfo describes a debug symbol bundle of the archive
+type DSYMInfo struct {
+	Name  string            `json:"name"`
+	Size  int64             `json:"size"`
+	UUIDs map[string]string `json:"uuids"`
+	// Binary is the Mach-O of the app the dSYM belongs to
+	Binary string `json:"binary,omitempty"`
+	// Status is "matched", "mismatched" when the binary was rebuilt since, or "unmatched"
+	Status string `json:"status"`
+
+	// attribution is computed from the symbol table of the dSYM, which stripping leaves complete
+	attribution *CodeAttribution
+}
+
+// analyzeXcarchiveContents reads the archive's metadata, products and dSYMs,
+// and checks that every binary of the analyzed app has a matching dSYM
+func analyzeXcarchiveContents(archivePath string, bundle *AppBundle) (*XcarchiveInfo, error) {
+	archiveFS := os.DirFS(archivePath)
+	info := &XcarchiveInfo{
+		Products: make([]ArchiveProduct, 0),
+		DSYMs:    make([]DSYMInfo, 0),
+	}
+
+	if err := readXcarchiveInfoPlist(archiveFS, info); err != nil {
+		fmt.Printf("Warning: failed to read archive Info.plist: %v\n", err)
+	}
+
+	products, err := findArchiveProducts(archiveFS)
+	if err != nil {
+		return nil, err
+	}
+	info.Products = products
+
+	info.DSYMs, err = analyzeDSYMs(archiveFS)
+	if err != nil {
+		return nil, err
+	}
+
+	info.MissingDSYMs = matchDSYMs(bundle.MachOFiles, info.DSYMs)
+	for _, binary := range info.MissingDSYMs {
+		fmt.Printf("Warning: no matching dSYM for %s, its crashes can't be symbolicated\n", binary)
+	}
+	for _, dsym := range info.DSYMs {
+		if dsym.Status == "mismatched" {
+			fmt.Printf("Warning: UUID of %s doesn't match %s\n", dsym.Name, dsym.Binary)
+		}
+	}
+	attributeFromDSYMs(bundle, info.DSYMs)
+
+	return info, nil
+}
+
+// readXcarchiveInfoPlist reads the archive metadata Xcode records in its Info.plist
+func readXcarchiveInfoPlist(fsys fs.FS, info *XcarchiveInfo) error {
+	data, err := readInfoPlist(fsys, "Info.plist")
+	if err != nil {
+		return err
+	}
+
+	info.Name, _ = data["Name"].(string)
+	info.SchemeName, _ = data["SchemeName"].(string)
+	if date, ok := data["CreationDate"].(time.Time); ok {
+		info.CreationDate = date.UTC().Format(time.RFC3339)
+	}
+	if properties, ok := data["ApplicationProperties"].(map[string]interface{}); ok {
+		info.SigningIdentity, _ = properties["SigningIdentity"].(string)
+		info.Team, _ = properties["Team"].(string)
+	}
+
+	return nil
+}
+
+// findArchiveProducts lists the bundles and files stored under Products
+func findArchiveProducts(fsys fs.FS) ([]ArchiveProduct, error) {
+	products := make([]ArchiveProduct, 0)
+	err := fs.WalkDir(fsys, "Products", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if name == "Products" {
+			return nil
+		}
+
+		// Bundles like .app and .framework are a single product
+		isBundle := entry.IsDir() && path.Ext(name) != ""
+		if !entry.IsDir() || isBundle {
+			files, err := AnalyzeFile(fsys, name)
+			if err != nil {
+				return err
+			}
+			products = append(products, ArchiveProduct{Path: name, Size: files.Size})
+		}
+		if isBundle {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find archive products: %v", err)
+	}
+
+	return products, nil
+}
+
+// analyzeDSYMs reads the size and the UUIDs of every dSYM of the archive
+func analyzeDSYMs(fsys fs.FS) ([]DSYMInfo, error) {
+	dsyms := make([]DSYMInfo, 0)
+
+	entries, err := fs.ReadDir(fsys, "dSYMs")
+	if errors.Is(err, fs.ErrNotExist) {
+		return dsyms, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read dSYMs: %v", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || filepath.Ext(entry.Name()) != ".dSYM" {
+			continue
+		}
+
+		dsymPath := path.Join("dSYMs", entry.Name())
+		files, err := AnalyzeFile(fsys, dsymPath)
+		if err != nil {
+			return nil, err
+		}
+		dsym := DSYMInfo{
+			Name:   entry.Name(),
+			Size:   files.Size,
+			UUIDs:  make(map[string]string),
+			Status: "unmatched",
+		}
+
+		// The DWARF directory holds a Mach-O with the same UUIDs as the binary
+		dwarfPath := path.Join(dsymPath, "Contents", "Resources", "DWARF")
+		dwarfFiles, err := fs.ReadDir(fsys, dwarfPath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read %s: %v", dwarfPath, err)
+		}
+		for _, dwarfFile := range dwarfFiles {
+			name := path.Join(dwarfPath, dwarfFile.Name())
+			if dwarfFile.IsDir() || !isMachOFile(fsys, name) {
+				continue
+			}
+			machO, err := analyzeMachO(fsys, name)
+			if err != nil {
+				fmt.Printf("Warning: failed to analyze %s: %v\n", name, err)
+				continue
+			}
+			for arch, uuid := range machO.UUIDs {
+				dsym.UUIDs[arch] = uuid
+			}
+			if dsym.attribution == nil {
+				dsym.attribution = machO.attribution
+			}
+		}
+
+		dsyms = append(dsyms, dsym)
+	}
+
+	return dsyms, nil
+}
+
+// matchDSYMs pairs the binaries of the app with the dSYMs by UUID and returns the binaries left without one
+func matchDSYMs(machOFiles []MachOInfo, dsyms []DSYMInfo) []string {
+	var missing []string
+
+	for _, machO := range machOFiles {
+		binaryName := path.Base(machO.Path)
+		matched := false
+		for i := range dsyms {
+			if len(machO.UUIDs) > 0 && containsUUIDs(dsyms[i].UUIDs, machO.UUIDs) {
+				dsyms[i].Binary = machO.Path
+				dsyms[i].Status = "matched"
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+
+		// A dSYM named after the binary that doesn't match was built from different sources
+		for i := range dsyms {
+			if dsyms[i].Status == "unmatched" && dsymBinaryName(dsyms[i].Name) == binaryName {
+				dsyms[i].Binary = machO.Path
+				dsyms[i].Status = "mismatched"
+			}
+		}
+		missing = append(missing, machO.Path)
+	}
+
+	sort.Strings(missing)
+	return missing
+}
+
+// attributeFromDSYMs replaces the code attribution of stripped binaries with the one of their matching dSYM
+func attributeFromDSYMs(bundle *AppBundle, dsyms []DSYMInfo) {
+	for _, dsym := range dsyms {
+		if dsym.Status != "matched" || dsym.attribution == nil {
+			continue
+		}
+
+		attribution := *dsym.attribution
+		attribution.Binary = dsym.Binary
+		replaced := false
+		for i := range bundle.CodeAttribution {
+			if bundle.CodeAttribution[i].Binary != dsym.Binary {
+				continue
+			}
+			if attribution.AttributedSize > bundle.CodeAttribution[i].AttributedSize {
+				bundle.CodeAttribution[i] = attribution
+			}
+			replaced = true
+		}
+		if !replaced && attribution.AttributedSize > 0 {
+			bundle.CodeAttribution = append(bundle.CodeAttribution, attribution)
+		}
+	}
+}
+
+// containsUUIDs reports whether every slice UUID of the binary is found in the dSYM
+func containsUUIDs(dsymUUIDs map[string]string, binaryUUIDs map[string]string) bool {
+	for arch, uuid := range binaryUUIDs {
+		if dsymUUIDs[arch] != uuid {
+			return false
+		}
+	}
+	return true
+}
+
+// dsymBinaryName returns the binary name of a dSYM like "App.app.dSYM" or "Kit.framework.dSYM"
+func dsymBinaryName(name string) string {
+	name = strings.TrimSuffix(name, ".dSYM")
+	return strings.TrimSuffix(name, path.Ext(name))
+}
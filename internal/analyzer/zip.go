@@ -2,58 +2,315 @@ package analyzer
 
 import (
 	"archive/zip"
+	"bytes"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
-	"path/filepath"
+	"path"
+	"strings"
 )
 
-func unzip(zip_path string) (string, error) {
-	tempDir, err := os.MkdirTemp("", "*")
+// inMemoryEntryLimit is the largest compressed entry that is inflated in memory
+// when random access is needed, larger ones are extracted to a temporary file
+const inMemoryEntryLimit = 64 << 20
+
+// ratioCheckThreshold is the uncompressed size from which the compression ratio of an entry is checked,
+// tiny files of repeated bytes legitimately compress far better than any real content
+const ratioCheckThreshold = 1 << 20
+
+// ArchiveLimits guards against archives that would exhaust the disk or memory of the build machine
+type ArchiveLimits struct {
+	// MaxEntries is the maximum number of entries of the archive
+	MaxEntries int
+	// MaxUncompressedSize is the maximum total uncompressed size of the entries
+	MaxUncompressedSize int64
+	// MaxCompressionRatio is the maximum uncompressed to compressed size ratio of a single entry
+	MaxCompressionRatio float64
+}
+
+// DefaultArchiveLimits are generous enough for the largest real-world apps
+var DefaultArchiveLimits = ArchiveLimits{
+	MaxEntries:          500000,
+	MaxUncompressedSize: 32 << 30,
+	MaxCompressionRatio: 1000,
+}
+
+// withDefaults fills the unset limits from DefaultArchiveLimits
+func (l ArchiveLimits) withDefaults() ArchiveLimits {
+	if l.MaxEntries <= 0 {
+		l.MaxEntries = DefaultArchiveLimits.MaxEntries
+	}
+	if l.MaxUncompressedSize <= 0 {
+		l.MaxUncompressedSize = DefaultArchiveLimits.MaxUncompressedSize
+	}
+	if l.MaxCompressionRatio <= 0 {
+		l.MaxCompressionRatio = DefaultArchiveLimits.MaxCompressionRatio
+	}
+	return l
+}
+
+// UnsafePathError is returned for entries, or symlink targets, that would resolve outside the archive
+type UnsafePathError struct {
+	Name   string
+	Target string
+}
+
+func (e *UnsafePathError) Error() string {
+	if e.Target != "" {
+		return fmt.Sprintf("unsafe symlink in archive: %s points to %s", e.Name, e.Target)
+	}
+	return fmt.Sprintf("unsafe path in archive: %s", e.Name)
+}
+
+// EntryLimitError is returned when the archive has more entries than allowed
+type EntryLimitError struct {
+	Entries int
+	Limit   int
+}
+
+func (e *EntryLimitError) Error() string {
+	return fmt.Sprintf("archive has %d entries, the limit is %d", e.Entries, e.Limit)
+}
+
+// SizeLimitError is returned when the entries of the archive add up to more than allowed
+type SizeLimitError struct {
+	Size  int64
+	Limit int64
+}
+
+func (e *SizeLimitError) Error() string {
+	return fmt.Sprintf("archive uncompresses to %d bytes, the limit is %d", e.Size, e.Limit)
+}
+
+// CompressionRatioError is returned for entries compressed suspiciously well, as in zip bombs
+type CompressionRatioError struct {
+	Name  string
+	Ratio float64
+	Limit float64
+}
+
+func (e *CompressionRatioError) Error() string {
+	return fmt.Sprintf("entry %s has a compression ratio of %.0f, the limit is %.0f", e.Name, e.Ratio, e.Limit)
+}
+
+// zipArchive is an open zip archive shared by every view of it
+type zipArchive struct {
+	file      readerAtFile
+	reader    *zip.Reader
+	entries   map[string]*zip.File
+	limits    ArchiveLimits
+	workspace *Workspace
+	tempDir   string
+}
+
+// archiveFS is a read-only fs.FS over the entries of a zip archive, rooted at prefix,
+// so archives can be analyzed in place without extracting them to disk
+type archiveFS struct {
+	archive *zipArchive
+	prefix  string
+}
+
+// openArchive opens the zip archive at zip_path for in place analysis, after checking its
+// entries against the limits, entries that have to be extracted go to the workspace
+func openArchive(zip_path string, limits ArchiveLimits, workspace *Workspace) (*archiveFS, error) {
+	file, err := os.Open(zip_path)
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp directory: %v", err)
+		return nil, fmt.Errorf("failed to open zip file: %v", err)
 	}
 
-	// Open the ZIP file
-	reader, err := zip.OpenReader(zip_path)
+	info, err := file.Stat()
 	if err != nil {
-		return "", fmt.Errorf("failed to open zip file: %v", err)
+		file.Close()
+		return nil, fmt.Errorf("failed to get zip file size: %v", err)
 	}
-	defer reader.Close()
 
-	// Extract all files to temp directory
-	for _, file := range reader.File {
-		filePath := filepath.Join(tempDir, file.Name)
+	return newArchiveFS(file, info.Size(), limits, workspace)
+}
+
+// openNestedArchive opens an archive stored in the archive, like a split APK of an .apks set,
+// it is checked against the same limits as the outer one
+func (a *archiveFS) openNestedArchive(name string) (*archiveFS, error) {
+	entry, ok := a.archive.entries[path.Join(a.prefix, name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
 
-		if file.FileInfo().IsDir() {
-			os.MkdirAll(filePath, os.ModePerm)
-			continue
+	file, err := a.openReaderAt(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return newArchiveFS(file, int64(entry.UncompressedSize64), a.archive.limits, a.archive.workspace)
+}
+
+// newArchiveFS reads the central directory of the zip archive in file, which is closed on failure
+func newArchiveFS(file readerAtFile, size int64, limits ArchiveLimits, workspace *Workspace) (*archiveFS, error) {
+	reader, err := zip.NewReader(file, size)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read zip file: %v", err)
+	}
+
+	limits = limits.withDefaults()
+	if err := checkArchive(reader, limits); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	archive := &zipArchive{
+		file:      file,
+		reader:    reader,
+		entries:   make(map[string]*zip.File, len(reader.File)),
+		limits:    limits,
+		workspace: workspace,
+	}
+	for _, entry := range reader.File {
+		archive.entries[entry.Name] = entry
+	}
+
+	return &archiveFS{archive: archive, prefix: "."}, nil
+}
+
+// checkArchive validates the paths, symlinks and sizes recorded in the central directory,
+// archive/zip fails reads that return more data than an entry declares
+func checkArchive(reader *zip.Reader, limits ArchiveLimits) error {
+	if len(reader.File) > limits.MaxEntries {
+		return &EntryLimitError{Entries: len(reader.File), Limit: limits.MaxEntries}
+	}
+
+	var totalSize uint64
+	for _, entry := range reader.File {
+		if !isSafeArchivePath(entry.Name) {
+			return &UnsafePathError{Name: entry.Name}
 		}
 
-		if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
-			return "", fmt.Errorf("failed to create directory: %v", err)
+		totalSize += entry.UncompressedSize64
+		if totalSize > uint64(limits.MaxUncompressedSize) {
+			return &SizeLimitError{Size: int64(totalSize), Limit: limits.MaxUncompressedSize}
 		}
 
-		dstFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode())
+		if entry.UncompressedSize64 >= ratioCheckThreshold {
+			ratio := float64(entry.UncompressedSize64) / float64(max(entry.CompressedSize64, 1))
+			if ratio > limits.MaxCompressionRatio {
+				return &CompressionRatioError{Name: entry.Name, Ratio: ratio, Limit: limits.MaxCompressionRatio}
+			}
+		}
+
+		// Symlinks are never followed, but one pointing outside the archive is a sign of tampering
+		if entry.Mode()&fs.ModeSymlink != 0 {
+			if entry.UncompressedSize64 > 4096 {
+				return &UnsafePathError{Name: entry.Name}
+			}
+			target, err := readZipFile(entry)
+			if err != nil {
+				return err
+			}
+			resolved := path.Join(path.Dir(entry.Name), string(target))
+			if path.IsAbs(string(target)) || !isSafeArchivePath(resolved) {
+				return &UnsafePathError{Name: entry.Name, Target: string(target)}
+			}
+		}
+	}
+
+	return nil
+}
+
+// isSafeArchivePath reports whether the entry name stays inside the archive root
+func isSafeArchivePath(name string) bool {
+	name = strings.TrimSuffix(name, "/")
+	if name == "" || strings.Contains(name, "\\") {
+		return false
+	}
+	return fs.ValidPath(name)
+}
+
+// Close closes the archive, the entries extracted from it are removed with the workspace
+func (a *archiveFS) Close() error {
+	return a.archive.file.Close()
+}
+
+// Open implements fs.FS
+func (a *archiveFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	return a.archive.reader.Open(path.Join(a.prefix, name))
+}
+
+// Sub returns the view of the archive rooted at dir
+func (a *archiveFS) Sub(dir string) *archiveFS {
+	return &archiveFS{archive: a.archive, prefix: path.Join(a.prefix, dir)}
+}
+
+// openReaderAt opens an entry for random access, stored entries are read
+// straight from the archive while deflated ones have to be inflated first
+func (a *archiveFS) openReaderAt(name string) (readerAtFile, error) {
+	entry, ok := a.archive.entries[path.Join(a.prefix, name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	if entry.Method == zip.Store {
+		offset, err := entry.DataOffset()
 		if err != nil {
-			return "", fmt.Errorf("failed to create file: %v", err)
+			return nil, fmt.Errorf("failed to locate %s: %v", entry.Name, err)
 		}
+		return nopCloser{io.NewSectionReader(a.archive.file, offset, int64(entry.UncompressedSize64))}, nil
+	}
 
-		srcFile, err := file.Open()
+	if entry.UncompressedSize64 <= inMemoryEntryLimit {
+		data, err := readZipFile(entry)
 		if err != nil {
-			dstFile.Close()
-			return "", fmt.Errorf("failed to open zip file: %v", err)
+			return nil, err
 		}
+		return nopCloser{bytes.NewReader(data)}, nil
+	}
+
+	return a.archive.extract(entry)
+}
 
-		if _, err := io.Copy(dstFile, srcFile); err != nil {
-			srcFile.Close()
-			dstFile.Close()
-			return "", fmt.Errorf("failed to extract file: %v", err)
+// extract writes the entry to a temporary file of the workspace
+func (a *zipArchive) extract(entry *zip.File) (*os.File, error) {
+	if a.tempDir == "" {
+		tempDir, err := a.workspace.TempDir("archive-*")
+		if err != nil {
+			return nil, err
 		}
+		a.tempDir = tempDir
+	}
+
+	dstFile, err := os.CreateTemp(a.tempDir, "entry-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %v", err)
+	}
 
-		srcFile.Close()
+	srcFile, err := entry.Open()
+	if err != nil {
+		dstFile.Close()
+		return nil, fmt.Errorf("failed to open %s: %v", entry.Name, err)
+	}
+	defer srcFile.Close()
+
+	if _, err := io.Copy(dstFile, srcFile); err != nil {
 		dstFile.Close()
+		return nil, fmt.Errorf("failed to extract %s: %v", entry.Name, err)
 	}
 
-	return tempDir, nil
+	return dstFile, nil
+}
+
+// readZipFile returns the uncompressed contents of the archive entry
+func readZipFile(file *zip.File) ([]byte, error) {
+	srcFile, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", file.Name, err)
+	}
+	defer srcFile.Close()
+
+	data, err := io.ReadAll(srcFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", file.Name, err)
+	}
+	return data, nil
 }
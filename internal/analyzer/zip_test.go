@@ -0,0 +1,154 @@
+package analyzer
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+// testZipEntry is an entry of testZip, symlinks hold their target as data
+type testZipEntry struct {
+	name    string
+	data    []byte
+	symlink bool
+	deflate bool
+}
+
+func testZip(t *testing.T, entries ...testZipEntry) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Store}
+		if entry.deflate {
+			header.Method = zip.Deflate
+		}
+		if entry.symlink {
+			header.SetMode(fs.ModeSymlink | 0o777)
+		}
+		f, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatalf("failed to create %s: %v", entry.name, err)
+		}
+		if _, err := f.Write(entry.data); err != nil {
+			t.Fatalf("failed to write %s: %v", entry.name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestNewArchiveFS(t *testing.T) {
+	file := testZipEntry{name: "Payload/App.app/App", data: []byte("binary")}
+	zeros := func(n int) []byte { return make([]byte, n) }
+
+	tests := []struct {
+		name    string
+		entries []testZipEntry
+		limits  ArchiveLimits
+		// target is a pointer to the type of the expected error, nil when the archive has to open
+		target any
+	}{
+		{name: "regular files", entries: []testZipEntry{file}},
+		{name: "parent directory", entries: []testZipEntry{file, {name: "../evil.sh", data: []byte("x")}}, target: new(*UnsafePathError)},
+		{name: "nested parent directory", entries: []testZipEntry{{name: "Payload/../../evil.sh"}}, target: new(*UnsafePathError)},
+		{name: "absolute path", entries: []testZipEntry{{name: "/etc/passwd"}}, target: new(*UnsafePathError)},
+		{name: "backslashes", entries: []testZipEntry{{name: `..\evil.sh`}}, target: new(*UnsafePathError)},
+		{
+			name:    "symlink inside the archive",
+			entries: []testZipEntry{file, {name: "Payload/App.app/Link", data: []byte("App"), symlink: true}},
+		},
+		{
+			name:    "symlink escaping the archive",
+			entries: []testZipEntry{{name: "Payload/App.app/Link", data: []byte("../../../etc"), symlink: true}},
+			target:  new(*UnsafePathError),
+		},
+		{
+			name:    "absolute symlink",
+			entries: []testZipEntry{{name: "Payload/App.app/Link", data: []byte("/etc/passwd"), symlink: true}},
+			target:  new(*UnsafePathError),
+		},
+		{
+			name:    "too many entries",
+			entries: []testZipEntry{file, {name: "a"}, {name: "b"}},
+			limits:  ArchiveLimits{MaxEntries: 2},
+			target:  new(*EntryLimitError),
+		},
+		{
+			name:    "too large",
+			entries: []testZipEntry{{name: "a", data: zeros(600)}, {name: "b", data: zeros(600)}},
+			limits:  ArchiveLimits{MaxUncompressedSize: 1000},
+			target:  new(*SizeLimitError),
+		},
+		{
+			name:    "compressed too well",
+			entries: []testZipEntry{{name: "bomb", data: zeros(2 << 20), deflate: true}},
+			limits:  ArchiveLimits{MaxCompressionRatio: 10},
+			target:  new(*CompressionRatioError),
+		},
+		{
+			// Small files of repeated bytes are not checked
+			name:    "compressed well under the ratio threshold",
+			entries: []testZipEntry{{name: "padding", data: zeros(ratioCheckThreshold - 1), deflate: true}},
+			limits:  ArchiveLimits{MaxCompressionRatio: 10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := testZip(t, tt.entries...)
+			archive, err := newArchiveFS(nopCloser{bytes.NewReader(data)}, int64(len(data)), tt.limits, nil)
+			if tt.target == nil {
+				if err != nil {
+					t.Fatalf("newArchiveFS() error = %v", err)
+				}
+				archive.Close()
+				return
+			}
+			if !errors.As(err, tt.target) {
+				t.Errorf("newArchiveFS() error = %v, want a %T", err, tt.target)
+			}
+		})
+	}
+}
+
+func TestArchiveFSReadsEntriesInPlace(t *testing.T) {
+	stored := []byte("stored binary")
+	deflated := bytes.Repeat([]byte("deflated "), 100)
+	data := testZip(t,
+		testZipEntry{name: "Payload/App.app/App", data: stored},
+		testZipEntry{name: "Payload/App.app/Info.plist", data: deflated, deflate: true},
+	)
+	archive, err := newArchiveFS(nopCloser{bytes.NewReader(data)}, int64(len(data)), ArchiveLimits{}, nil)
+	if err != nil {
+		t.Fatalf("newArchiveFS() error = %v", err)
+	}
+	defer archive.Close()
+
+	app := archive.Sub("Payload/App.app")
+	for name, want := range map[string][]byte{"App": stored, "Info.plist": deflated} {
+		got, err := fs.ReadFile(app, name)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("ReadFile(%s) = %q, %v, want %q", name, got, err, want)
+		}
+
+		r, err := app.openReaderAt(name)
+		if err != nil {
+			t.Fatalf("openReaderAt(%s) error = %v", name, err)
+		}
+		tail := make([]byte, 4)
+		if _, err := r.ReadAt(tail, int64(len(want)-4)); err != nil || !bytes.Equal(tail, want[len(want)-4:]) {
+			t.Errorf("ReadAt(%s) = %q, %v, want %q", name, tail, err, want[len(want)-4:])
+		}
+		r.Close()
+	}
+
+	if _, err := fs.ReadFile(app, "../../evil.sh"); err == nil {
+		t.Errorf("ReadFile() of a path outside the archive succeeded")
+	}
+	if _, err := app.openReaderAt("Missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("openReaderAt() of a missing entry error = %v, want fs.ErrNotExist", err)
+	}
+}
@@ -30,6 +30,82 @@ func FindLargestFiles(root analyzer.FileInfo) []analyzer.FileInfo {
 	return files
 }
 
+// WithCompressedSizes returns a copy of the tree sized by compressed (download) size
+func WithCompressedSizes(root analyzer.FileInfo) analyzer.FileInfo {
+	root.Size = root.CompressedSize
+	if len(root.Children) > 0 {
+		children := make([]analyzer.FileInfo, len(root.Children))
+		for i, child := range root.Children {
+			children[i] = WithCompressedSizes(child)
+		}
+		root.Children = children
+	}
+	return root
+}
+
+// FlattenChildBundles returns the embedded targets of the bundle, nested targets following their parent
+func FlattenChildBundles(children []analyzer.ChildBundle) []analyzer.ChildBundle {
+	flattened := make([]analyzer.ChildBundle, 0)
+	for _, child := range children {
+		flattened = append(flattened, child)
+		flattened = append(flattened, FlattenChildBundles(child.ChildBundles)...)
+	}
+	return flattened
+}
+
+// BinarySection is a section of an architecture slice of a Mach-O binary
+type BinarySection struct {
+	Binary       string
+	Architecture string
+	Segment      string
+	Section      string
+	Size         int64
+}
+
+// FindLargestSections returns the sections of every binary slice sorted by size
+func FindLargestSections(machOFiles []analyzer.MachOInfo) []BinarySection {
+	sections := make([]BinarySection, 0)
+	for _, machO := range machOFiles {
+		for arch, segments := range machO.Segments {
+			for _, segment := range segments {
+				for _, section := range segment.Sections {
+					sections = append(sections, BinarySection{
+						Binary:       machO.Path,
+						Architecture: arch,
+						Segment:      segment.Name,
+						Section:      section.Name,
+						Size:         section.Size,
+					})
+				}
+			}
+		}
+	}
+
+	// Sort by size in descending order
+	sort.Slice(sections, func(i, j int) bool {
+		return sections[i].Size > sections[j].Size
+	})
+
+	return sections
+}
+
+// BinaryLinkMap is a link map along with the binary it was written for
+type BinaryLinkMap struct {
+	Binary string
+	analyzer.LinkMap
+}
+
+// FindLinkMaps returns the link maps of every binary
+func FindLinkMaps(machOFiles []analyzer.MachOInfo) []BinaryLinkMap {
+	linkMaps := make([]BinaryLinkMap, 0)
+	for _, machO := range machOFiles {
+		for _, linkMap := range machO.LinkMaps {
+			linkMaps = append(linkMaps, BinaryLinkMap{Binary: machO.Path, LinkMap: linkMap})
+		}
+	}
+	return linkMaps
+}
+
 // CountFiles returns the number of files (non-directory nodes) in a FileInfo tree
 func CountFiles(root analyzer.FileInfo) int {
 	count := 0
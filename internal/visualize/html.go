@@ -30,6 +30,34 @@ type templateData struct {
 	LargestModules []analyzer.FileInfo
 	TypeBreakdown  []TypeBreakdown
 	Duplicates     []DuplicateGroup
+	HasModules     bool
+	HasMachO       bool
+	HasDex         bool
+	HasResources   bool
+	SizeEstimates  *analyzer.SizeEstimates
+	Variants       []analyzer.ThinnedVariant
+
+	// Largest files and modules ranked by compressed (download) size
+	LargestDownloadFiles   []analyzer.FileInfo
+	LargestDownloadModules []analyzer.FileInfo
+
+	// Install size without rounding files up to the filesystem block size
+	LogicalInstallSize string
+
+	Xcarchive    *analyzer.XcarchiveInfo
+	ChildBundles []analyzer.ChildBundle
+
+	Slices []analyzer.XCFrameworkSlice
+
+	Splits []analyzer.ApkSplit
+
+	CodeAttribution []analyzer.CodeAttribution
+	LinkMaps        []BinaryLinkMap
+
+	NativeAbis      []analyzer.NativeAbi
+	NativeLibraries []analyzer.NativeLibrary
+
+	Resources *analyzer.ResourceBreakdown
 }
 
 // formatSize converts bytes to a human-readable string
@@ -67,10 +95,13 @@ func GenerateHTML(bundle *analyzer.AppBundle, outputDir string) error {
 	if err != nil {
 		return fmt.Errorf("failed to get file info: %v", err)
 	}
-	fileTreeJSON, err := json.Marshal(fileInfo)
+	// Only the treemap drills into binaries, the rankings below keep them, DEX files and resource tables as single files
+	treemapInfo := analyzer.FilesIncludingMachOSegments(fileInfo, bundle)
+	fileTreeJSON, err := json.Marshal(treemapInfo)
 	if err != nil {
 		return fmt.Errorf("failed to marshal file tree: %v", err)
 	}
+	fileInfo = analyzer.FilesExcludingDexAndResourceTables(fileInfo)
 
 	// Pre-calculate largest files and modules
 	largestFiles := FindLargestFiles(fileInfo)
@@ -83,6 +114,18 @@ func GenerateHTML(bundle *analyzer.AppBundle, outputDir string) error {
 		largestModules = largestModules[:10]
 	}
 
+	// Rank by download size as well, the report can toggle between the two
+	compressedInfo := WithCompressedSizes(fileInfo)
+	largestDownloadFiles := FindLargestFiles(compressedInfo)
+	if len(largestDownloadFiles) > 10 {
+		largestDownloadFiles = largestDownloadFiles[:10]
+	}
+
+	largestDownloadModules := FindLargestModules(compressedInfo)
+	if len(largestDownloadModules) > 10 {
+		largestDownloadModules = largestDownloadModules[:10]
+	}
+
 	// Calculate type breakdown
 	typeBreakdown := CalculateTypeBreakdown(fileInfo)
 
@@ -103,6 +146,33 @@ func GenerateHTML(bundle *analyzer.AppBundle, outputDir string) error {
 		LargestModules: largestModules,
 		TypeBreakdown:  typeBreakdown,
 		Duplicates:     duplicates,
+		HasModules:     len(bundle.Modules) > 0,
+		HasMachO:       len(bundle.MachOFiles) > 0,
+		HasDex:         len(bundle.DexPackages) > 0,
+		HasResources:   len(bundle.ResourceTables) > 0,
+		SizeEstimates:  bundle.SizeEstimates,
+		Variants:       bundle.Variants,
+
+		LargestDownloadFiles:   largestDownloadFiles,
+		LargestDownloadModules: largestDownloadModules,
+
+		Xcarchive:    bundle.Xcarchive,
+		ChildBundles: FlattenChildBundles(bundle.ChildBundles),
+
+		Slices: bundle.Slices,
+
+		Splits: bundle.Splits,
+
+		CodeAttribution: bundle.CodeAttribution,
+		LinkMaps:        FindLinkMaps(bundle.MachOFiles),
+
+		NativeAbis:      bundle.NativeAbis,
+		NativeLibraries: bundle.NativeLibraries,
+
+		Resources: bundle.Resources,
+	}
+	if bundle.LogicalInstallSize > 0 {
+		data.LogicalInstallSize = formatSize(bundle.LogicalInstallSize)
 	}
 
 	// Create a buffer to store the rendered template
@@ -31,8 +31,9 @@ type duplicateInfo struct {
 	isAsset     bool     // whether this is an asset catalog duplicate
 }
 
-// GenerateMarkdown generates a Markdown file containing the bundle analysis data
-func GenerateMarkdown(bundle *analyzer.AppBundle, outputDir string) error {
+// GenerateMarkdown generates a Markdown file containing the bundle analysis data,
+// ranking modules and files by download size instead of install size when rankByDownload is set
+func GenerateMarkdown(bundle *analyzer.AppBundle, outputDir string, rankByDownload bool) error {
 	// Create Markdown file named after bundle ID
 	mdFileName := fmt.Sprintf("%s.md", bundle.BundleID)
 	mdPath := filepath.Join(outputDir, mdFileName)
@@ -52,47 +53,208 @@ func GenerateMarkdown(bundle *analyzer.AppBundle, outputDir string) error {
 	content.WriteString(fmt.Sprintf("| Minimum OS Version | %s |\n", bundle.MinimumOSVersion))
 	content.WriteString(fmt.Sprintf("| Download Size | %s |\n", formatSize(bundle.DownloadSize)))
 	content.WriteString(fmt.Sprintf("| Install Size | %s |\n", formatSize(bundle.InstallSize)))
+	if bundle.LogicalInstallSize > 0 {
+		content.WriteString(fmt.Sprintf("| Logical Install Size | %s |\n", formatSize(bundle.LogicalInstallSize)))
+	}
 	content.WriteString(fmt.Sprintf("| Supported Platforms | %s |\n\n", strings.Join(bundle.SupportedPlatforms, ", ")))
 
+	// App Bundle modules
+	if len(bundle.Modules) > 0 {
+		content.WriteString("## 🧩 Bundle Modules\n\n")
+		content.WriteString("| Module | Type | Delivery | Size |\n")
+		content.WriteString("|--------|------|----------|------|\n")
+		for _, module := range bundle.Modules {
+			content.WriteString(fmt.Sprintf("| %s | %s | %s | %s |\n",
+				module.Name,
+				module.Type,
+				module.Delivery,
+				formatSize(module.Size)))
+		}
+		content.WriteString("\n")
+	}
+
+	// Split APKs of .apks sets
+	if len(bundle.Splits) > 0 {
+		content.WriteString("## 🪓 Split APKs\n\n")
+		content.WriteString("| Split | Module | Type | Config | Delivery | Download Size | Install Size |\n")
+		content.WriteString("|-------|--------|------|--------|----------|---------------|--------------|\n")
+		for _, split := range bundle.Splits {
+			content.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s | %s | %s |\n",
+				split.Name,
+				split.Module,
+				split.Type,
+				split.Config,
+				split.Delivery,
+				formatSize(split.DownloadSize),
+				formatSize(split.InstallSize)))
+		}
+		content.WriteString("\n")
+	}
+
+	// Embedded app extensions, App Clips and watch apps
+	if len(bundle.ChildBundles) > 0 {
+		content.WriteString("## 🧩 Targets\n\n")
+		content.WriteString("| Target | Kind | Bundle ID | Version | Minimum OS Version | Extension Point | Size |\n")
+		content.WriteString("|--------|------|-----------|---------|--------------------|-----------------|------|\n")
+		for _, child := range FlattenChildBundles(bundle.ChildBundles) {
+			content.WriteString(fmt.Sprintf("| %s | %s | `%s` | %s | %s | %s | %s |\n",
+				child.Path,
+				child.Kind,
+				child.BundleID,
+				child.Version,
+				child.MinimumOSVersion,
+				child.ExtensionPoint,
+				formatSize(child.Size)))
+		}
+		content.WriteString("\n")
+	}
+
+	// Per-device size estimates of App Bundles
+	if estimates := bundle.SizeEstimates; estimates != nil {
+		content.WriteString("## 📲 Device Size Estimates\n\n")
+		content.WriteString(fmt.Sprintf("Split by: %s\n\n", strings.Join(estimates.SplitDimensions, ", ")))
+		content.WriteString("| | Min | Max |\n")
+		content.WriteString("|---|-----|-----|\n")
+		content.WriteString(fmt.Sprintf("| Download Size | %s | %s |\n", formatSize(estimates.MinDownloadSize), formatSize(estimates.MaxDownloadSize)))
+		content.WriteString(fmt.Sprintf("| Install Size | %s | %s |\n\n", formatSize(estimates.MinInstallSize), formatSize(estimates.MaxInstallSize)))
+
+		content.WriteString("| Device | ABI | Density | Language | Download Size | Install Size |\n")
+		content.WriteString("|--------|-----|---------|----------|---------------|--------------|\n")
+		for _, device := range estimates.Devices {
+			content.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s | %s |\n",
+				device.Name,
+				device.Abi,
+				device.ScreenDensity,
+				device.Language,
+				formatSize(device.DownloadSize),
+				formatSize(device.InstallSize)))
+		}
+		content.WriteString("\n")
+	}
+
+	// App Thinning variants of iOS apps
+	if len(bundle.Variants) > 0 {
+		content.WriteString("## 📐 App Thinning Variants\n\n")
+		content.WriteString("| Variant | Architecture | Download Size | Install Size |\n")
+		content.WriteString("|---------|--------------|---------------|--------------|\n")
+		for _, variant := range bundle.Variants {
+			content.WriteString(fmt.Sprintf("| %s | %s | %s | %s |\n",
+				variant.Name,
+				variant.Architecture,
+				formatSize(variant.DownloadSize),
+				formatSize(variant.InstallSize)))
+		}
+		content.WriteString("\n")
+	}
+
+	// Per-platform libraries of .xcframework inputs
+	if len(bundle.Slices) > 0 {
+		content.WriteString("## 🧱 XCFramework Slices\n\n")
+		content.WriteString("| Slice | Platform | Architectures | Library | Size | Download Size | Debug Symbols |\n")
+		content.WriteString("|-------|----------|---------------|---------|------|---------------|---------------|\n")
+		staticArchives := false
+		for _, slice := range bundle.Slices {
+			platform := slice.Platform
+			if slice.PlatformVariant != "" {
+				platform += " (" + slice.PlatformVariant + ")"
+			}
+			library := slice.LibraryPath
+			if slice.StaticArchive {
+				library += " ¹"
+				staticArchives = true
+			}
+			content.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s | %s | %s |\n",
+				slice.Identifier,
+				platform,
+				strings.Join(slice.Architectures, ", "),
+				library,
+				formatSize(slice.Size),
+				formatSize(slice.CompressedSize),
+				formatSize(slice.DebugSymbolsSize)))
+		}
+		content.WriteString("\n")
+		if staticArchives {
+			content.WriteString("¹ Static library, its object files are not broken down into segments and sections.\n\n")
+		}
+	}
+
+	// Archive metadata and debug symbols of .xcarchive inputs
+	if archive := bundle.Xcarchive; archive != nil {
+		content.WriteString("## 🗄️ Archive\n\n")
+		content.WriteString("| Property | Value |\n")
+		content.WriteString("|----------|-------|\n")
+		content.WriteString(fmt.Sprintf("| Name | %s |\n", archive.Name))
+		content.WriteString(fmt.Sprintf("| Scheme | %s |\n", archive.SchemeName))
+		content.WriteString(fmt.Sprintf("| Created | %s |\n", archive.CreationDate))
+		content.WriteString(fmt.Sprintf("| Signing Identity | %s |\n", archive.SigningIdentity))
+		content.WriteString(fmt.Sprintf("| Team | %s |\n\n", archive.Team))
+
+		content.WriteString("| Product | Size |\n")
+		content.WriteString("|---------|------|\n")
+		for _, product := range archive.Products {
+			content.WriteString(fmt.Sprintf("| %s | %s |\n", product.Path, formatSize(product.Size)))
+		}
+		content.WriteString("\n")
+
+		content.WriteString("| dSYM | Binary | Status | Size |\n")
+		content.WriteString("|------|--------|--------|------|\n")
+		for _, dsym := range archive.DSYMs {
+			status := "✅ matched"
+			if dsym.Status != "matched" {
+				status = "⚠️ " + dsym.Status
+			}
+			content.WriteString(fmt.Sprintf("| %s | %s | %s | %s |\n",
+				dsym.Name,
+				dsym.Binary,
+				status,
+				formatSize(dsym.Size)))
+		}
+		for _, binary := range archive.MissingDSYMs {
+			content.WriteString(fmt.Sprintf("| | %s | ⚠️ missing | |\n", binary))
+		}
+		content.WriteString("\n")
+	}
+
+	// Rank by install size, or by the compressed size each file adds to the download
+	rankedFiles := bundle.Files
+	rankedTotal := bundle.InstallSize
+	rankedBy := "install size"
+	if rankByDownload {
+		rankedFiles = WithCompressedSizes(bundle.Files)
+		// The download size of app bundles and split sets is an estimate of the generated APKs, not of these files
+		rankedTotal = rankedFiles.Size
+		rankedBy = "download size"
+	}
+
 	// Top 10 Largest Modules
 	content.WriteString("## 📦 Top 10 Largest Modules\n\n")
 	content.WriteString("<details>\n")
 
-	modules := FindLargestModules(bundle.Files)
+	modules := FindLargestModules(rankedFiles)
 
-	// Count modules (excluding root)
+	// FindLargestModules leaves out the root, take up to 10 modules
 	moduleCount := len(modules)
-	if moduleCount > 0 {
-		moduleCount-- // Subtract root module
-	}
 	if moduleCount > 10 {
 		moduleCount = 10
 	}
 
 	totalSize := int64(0)
-	for _, module := range modules[1:] {
+	for _, module := range modules[:moduleCount] {
 		totalSize += module.Size
 	}
 
-	content.WriteString(fmt.Sprintf("<summary>Found %d modules totaling %s, click to expand</summary>\n\n",
-		moduleCount, formatSize(totalSize)))
+	content.WriteString(fmt.Sprintf("<summary>Found %d modules totaling %s by %s, click to expand</summary>\n\n",
+		moduleCount, formatSize(totalSize), rankedBy))
 	content.WriteString("| Module | Size | File Count | % of Total |\n")
 	content.WriteString("|--------|------|------------|------------|\n")
 
-	// Skip the root module (index 0) and take up to 10 modules
-	endIndex := len(modules)
-	if endIndex > 11 { // 11 because we skip the first one
-		endIndex = 11
-	}
-	if endIndex > 1 { // Only process if we have modules beyond the root
-		for _, module := range modules[1:endIndex] {
-			percentage := float64(module.Size) / float64(bundle.InstallSize) * 100
-			content.WriteString(fmt.Sprintf("| %s | %s | %d | %.1f%% |\n",
-				module.RelativePath,
-				formatSize(module.Size),
-				CountFiles(module),
-				percentage))
-		}
+	for _, module := range modules[:moduleCount] {
+		percentage := float64(module.Size) / float64(rankedTotal) * 100
+		content.WriteString(fmt.Sprintf("| %s | %s | %d | %.1f%% |\n",
+			module.RelativePath,
+			formatSize(module.Size),
+			CountFiles(module),
+			percentage))
 	}
 	content.WriteString("\n</details>\n\n")
 
@@ -100,7 +262,7 @@ func GenerateMarkdown(bundle *analyzer.AppBundle, outputDir string) error {
 	content.WriteString("## 📄 Top 10 Largest Files\n\n")
 	content.WriteString("<details>\n")
 
-	files := FindLargestFiles(bundle.Files)
+	files := FindLargestFiles(rankedFiles)
 	fileCount := len(files)
 	if fileCount > 10 {
 		fileCount = 10
@@ -111,8 +273,8 @@ func GenerateMarkdown(bundle *analyzer.AppBundle, outputDir string) error {
 		totalFileSize += files[i].Size
 	}
 
-	content.WriteString(fmt.Sprintf("<summary>Found %d large files totaling %s, click to expand</summary>\n\n",
-		fileCount, formatSize(totalFileSize)))
+	content.WriteString(fmt.Sprintf("<summary>Found %d large files totaling %s by %s, click to expand</summary>\n\n",
+		fileCount, formatSize(totalFileSize), rankedBy))
 	content.WriteString("| File | Size | % of Total |\n")
 	content.WriteString("|------|------|------------|\n")
 
@@ -120,7 +282,7 @@ func GenerateMarkdown(bundle *analyzer.AppBundle, outputDir string) error {
 		if i >= 10 {
 			break
 		}
-		percentage := float64(file.Size) / float64(bundle.InstallSize) * 100
+		percentage := float64(file.Size) / float64(rankedTotal) * 100
 		content.WriteString(fmt.Sprintf("| %s | %s | %.1f%% |\n",
 			file.RelativePath,
 			formatSize(file.Size),
@@ -128,6 +290,201 @@ func GenerateMarkdown(bundle *analyzer.AppBundle, outputDir string) error {
 	}
 	content.WriteString("\n</details>\n\n")
 
+	// Top 10 Largest Binary Sections
+	if sections := FindLargestSections(bundle.MachOFiles); len(sections) > 0 {
+		content.WriteString("## 🔬 Top 10 Largest Binary Sections\n\n")
+		content.WriteString("<details>\n")
+		content.WriteString(fmt.Sprintf("<summary>Found %d sections in %d binaries, click to expand</summary>\n\n",
+			len(sections), len(bundle.MachOFiles)))
+		content.WriteString("| Binary | Architecture | Segment | Section | Size |\n")
+		content.WriteString("|--------|--------------|---------|---------|------|\n")
+		for i, section := range sections {
+			if i >= 10 {
+				break
+			}
+			content.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s |\n",
+				section.Binary,
+				section.Architecture,
+				section.Segment,
+				section.Section,
+				formatSize(section.Size)))
+		}
+		content.WriteString("\n</details>\n\n")
+	}
+
+	// Code attribution of the binaries
+	for _, attribution := range bundle.CodeAttribution {
+		content.WriteString(fmt.Sprintf("## 🧬 Code Attribution: %s\n\n", attribution.Binary))
+		content.WriteString(fmt.Sprintf("%s of the %s of sections of the %s slice are covered by symbols.\n\n",
+			formatSize(attribution.AttributedSize), formatSize(attribution.SectionsSize), attribution.Architecture))
+		writeAttributedGroups(&content, "Modules", "Module", attribution.Modules)
+		writeAttributedGroups(&content, "Types", "Type", attribution.Types)
+		writeAttributedGroups(&content, "Objective-C Classes", "Class", attribution.ObjCClasses)
+		if len(attribution.Symbols) > 0 {
+			content.WriteString("<details>\n")
+			content.WriteString("<summary>Top 10 Symbols, click to expand</summary>\n\n")
+			content.WriteString("| Symbol | Section | Size |\n")
+			content.WriteString("|--------|---------|------|\n")
+			for i, symbol := range attribution.Symbols {
+				if i >= 10 {
+					break
+				}
+				content.WriteString(fmt.Sprintf("| `%s` | %s | %s |\n",
+					escapeTableCell(symbol.Name),
+					symbol.Section,
+					formatSize(symbol.Size)))
+			}
+			content.WriteString("\n</details>\n\n")
+		}
+	}
+
+	// Static libraries and pods the binaries were linked from
+	for _, linkMap := range FindLinkMaps(bundle.MachOFiles) {
+		content.WriteString(fmt.Sprintf("## 📚 Linked Libraries: %s (%s)\n\n", linkMap.Binary, linkMap.Architecture))
+		content.WriteString("<details>\n")
+		content.WriteString(fmt.Sprintf("<summary>Found %d libraries in %s, click to expand</summary>\n\n",
+			len(linkMap.Libraries), filepath.Base(linkMap.Path)))
+		content.WriteString("| Library | Object Files | __TEXT | __DATA | Size |\n")
+		content.WriteString("|---------|--------------|--------|--------|------|\n")
+		for i, library := range linkMap.Libraries {
+			if i >= 10 {
+				break
+			}
+			content.WriteString(fmt.Sprintf("| %s | %d | %s | %s | %s |\n",
+				library.Name,
+				library.ObjectFiles,
+				formatSize(library.TextSize),
+				formatSize(library.DataSize),
+				formatSize(library.Size)))
+		}
+		content.WriteString("\n</details>\n\n")
+	}
+
+	// Native libraries of Android apps
+	if len(bundle.NativeLibraries) > 0 {
+		content.WriteString("## ⚙️ Native Libraries\n\n")
+		content.WriteString("| ABI | Libraries | Size | Compressed Size | 16 KB Pages |\n")
+		content.WriteString("|-----|-----------|------|-----------------|-------------|\n")
+		for _, abi := range bundle.NativeAbis {
+			pageSizeCheck := "✅ Pass"
+			if !abi.Is64Bit {
+				pageSizeCheck = "➖ N/A"
+			} else if !abi.Supports16KBPages {
+				pageSizeCheck = "❌ Fail"
+			}
+			content.WriteString(fmt.Sprintf("| %s | %d | %s | %s | %s |\n",
+				abi.Abi,
+				abi.Libraries,
+				formatSize(abi.Size),
+				formatSize(abi.CompressedSize),
+				pageSizeCheck))
+		}
+		content.WriteString("\n")
+
+		// Libraries that can't be loaded on devices with 16 KB pages
+		for _, library := range bundle.NativeLibraries {
+			for _, issue := range library.PageSizeIssues {
+				content.WriteString(fmt.Sprintf("- ❌ `%s`: %s\n", library.Path, issue))
+			}
+		}
+		for _, library := range bundle.NativeLibraries {
+			if len(library.PageSizeIssues) > 0 {
+				content.WriteString("\n")
+				break
+			}
+		}
+
+		libraries := make([]analyzer.NativeLibrary, len(bundle.NativeLibraries))
+		copy(libraries, bundle.NativeLibraries)
+		sort.Slice(libraries, func(i, j int) bool {
+			return libraries[i].Size > libraries[j].Size
+		})
+		content.WriteString("<details>\n")
+		content.WriteString(fmt.Sprintf("<summary>Top 10 of %d native libraries, click to expand</summary>\n\n", len(libraries)))
+		content.WriteString("| Library | ABI | Size | Stripped | Debug Info | Exported Symbols | Dependencies | LOAD Alignment | Compression |\n")
+		content.WriteString("|---------|-----|------|----------|------------|------------------|--------------|----------------|-------------|\n")
+		for i, library := range libraries {
+			if i >= 10 {
+				break
+			}
+			stripped := "No"
+			if library.Stripped {
+				stripped = "Yes"
+			}
+			compression := library.Compression
+			if library.Compression == "stored" {
+				compression = fmt.Sprintf("stored at %d (%s aligned)", library.ZipOffset, formatSize(library.ZipAlignment))
+			}
+			content.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s | %d | %s | %s | %s |\n",
+				library.Path,
+				library.Abi,
+				formatSize(library.Size),
+				stripped,
+				formatSize(library.DebugInfoSize),
+				library.ExportedSymbolCount,
+				strings.Join(library.Needed, ", "),
+				formatSize(library.LoadAlignment),
+				compression))
+		}
+		content.WriteString("\n</details>\n\n")
+	}
+
+	// Resource values and res/ files by type and configuration
+	if resources := bundle.Resources; resources != nil {
+		var values, configurations int
+		for _, table := range bundle.ResourceTables {
+			values += table.Values
+			configurations += table.Configurations
+		}
+		content.WriteString("## 🎨 Resources\n\n")
+		content.WriteString(fmt.Sprintf("%d values in %d configurations of %d resource tables.\n\n",
+			values, configurations, len(bundle.ResourceTables)))
+		writeResourceGroups(&content, "Types", "Type", resources.Types)
+		writeResourceGroups(&content, "Densities", "Density", resources.Densities)
+		writeResourceGroups(&content, "Locales", "Locale", resources.Locales)
+		writeResourceGroups(&content, "Night Modes", "Night Mode", resources.NightModes)
+		writeResourceGroups(&content, "API Levels", "API Level", resources.ApiLevels)
+		writeResourceGroups(&content, "Configurations", "Configuration", resources.Configurations)
+
+		if len(resources.Files) > 0 {
+			content.WriteString("<details>\n")
+			content.WriteString("<summary>Top 10 Resource Files, click to expand</summary>\n\n")
+			content.WriteString("| File | Resource | Configuration | Size |\n")
+			content.WriteString("|------|----------|---------------|------|\n")
+			for i, file := range resources.Files {
+				if i >= 10 {
+					break
+				}
+				content.WriteString(fmt.Sprintf("| %s | %s | %s | %s |\n",
+					file.Path,
+					file.Resource,
+					file.Qualifiers,
+					formatSize(file.Size)))
+			}
+			content.WriteString("\n</details>\n\n")
+		}
+
+		if len(resources.RedundantValues) > 0 {
+			content.WriteString(fmt.Sprintf("%s could be saved by removing values equal to the one of another configuration.\n\n",
+				formatSize(resources.RedundantSize)))
+			content.WriteString("<details>\n")
+			content.WriteString("<summary>Top 10 Redundant Values, click to expand</summary>\n\n")
+			content.WriteString("| Resource | Configuration | Same As | Size |\n")
+			content.WriteString("|----------|---------------|---------|------|\n")
+			for i, value := range resources.RedundantValues {
+				if i >= 10 {
+					break
+				}
+				content.WriteString(fmt.Sprintf("| %s | %s | %s | %s |\n",
+					value.Resource,
+					value.Configuration,
+					value.SameAs,
+					formatSize(value.Size)))
+			}
+			content.WriteString("\n</details>\n\n")
+		}
+	}
+
 	// Collect all duplicates
 	var allDuplicates []duplicateInfo
 
@@ -253,3 +610,55 @@ func getRelativePaths(files []analyzer.FileInfo) []string {
 	}
 	return paths
 }
+
+// writeAttributedGroups writes the 10 largest groups of a code attribution as a collapsed table
+func writeAttributedGroups(content *strings.Builder, title string, column string, groups []analyzer.AttributedGroup) {
+	if len(groups) == 0 {
+		return
+	}
+
+	content.WriteString("<details>\n")
+	content.WriteString(fmt.Sprintf("<summary>Top 10 %s, click to expand</summary>\n\n", title))
+	content.WriteString(fmt.Sprintf("| %s | Symbols | Size |\n", column))
+	content.WriteString("|--------|---------|------|\n")
+	for i, group := range groups {
+		if i >= 10 {
+			break
+		}
+		content.WriteString(fmt.Sprintf("| %s | %d | %s |\n",
+			escapeTableCell(group.Name),
+			group.Symbols,
+			formatSize(group.Size)))
+	}
+	content.WriteString("\n</details>\n\n")
+}
+
+// writeResourceGroups writes the 10 largest resource types or configurations as a collapsible table
+func writeResourceGroups(content *strings.Builder, title string, column string, groups []analyzer.ResourceGroup) {
+	if len(groups) == 0 {
+		return
+	}
+
+	content.WriteString("<details>\n")
+	content.WriteString(fmt.Sprintf("<summary>Top 10 of %d %s, click to expand</summary>\n\n", len(groups), title))
+	content.WriteString(fmt.Sprintf("| %s | Values | Table Size | Files | Files Size | Size |\n", column))
+	content.WriteString("|--------|--------|------------|-------|------------|------|\n")
+	for i, group := range groups {
+		if i >= 10 {
+			break
+		}
+		content.WriteString(fmt.Sprintf("| %s | %d | %s | %d | %s | %s |\n",
+			group.Name,
+			group.Values,
+			formatSize(group.TableSize),
+			group.Files,
+			formatSize(group.FilesSize),
+			formatSize(group.Size)))
+	}
+	content.WriteString("\n</details>\n\n")
+}
+
+// escapeTableCell escapes the pipes of C++ operator names, which would split the table cell
+func escapeTableCell(text string) string {
+	return strings.ReplaceAll(text, "|", "\\|")
+}